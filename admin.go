@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ActivityRow is a backend of the current database as reported by pg_stat_activity.
+type ActivityRow struct {
+	PID      int32
+	State    string
+	Query    string
+	Duration time.Duration // time since the current or last query started
+}
+
+// BackendPID returns the server process ID of an acquired connection, as an int32 like the pid columns of pg_stat_activity.
+func BackendPID(conn *pgxpool.Conn) int32 {
+	return int32(conn.Conn().PgConn().PID())
+}
+
+// CancelBackend cancels the current query of the backend with the given PID using pg_cancel_backend.
+func (p *Pool) CancelBackend(ctx context.Context, pid int32) error {
+	return p.signalBackend(ctx, "pg_cancel_backend", pid)
+}
+
+// TerminateBackend terminates the backend with the given PID using pg_terminate_backend.
+func (p *Pool) TerminateBackend(ctx context.Context, pid int32) error {
+	return p.signalBackend(ctx, "pg_terminate_backend", pid)
+}
+
+func (p *Pool) signalBackend(ctx context.Context, function string, pid int32) error {
+	ok, err := Scalar[bool](ctx, p, "SELECT "+function+"($1)", pid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: backend %d was not signalled", function, pid)
+	}
+	return nil
+}
+
+// IsPrimary reports whether the server of a pool connection is a primary, i.e. not in recovery as a standby.
+// With several hosts connections may go to different servers, so the answer holds for the connection that ran the check.
+func (p *Pool) IsPrimary(ctx context.Context) (bool, error) {
+	return Scalar[bool](ctx, p, "SELECT NOT pg_is_in_recovery()")
+}
+
+// ActiveQueries returns the backends connected to the current database, excluding the one running this query.
+// Idle backends are skipped unless includeIdle is true.
+func (p *Pool) ActiveQueries(ctx context.Context, includeIdle bool) ([]ActivityRow, error) {
+	rows, err := p.Query(ctx, `SELECT pid, coalesce(state, ''), coalesce(query, ''),
+		coalesce(extract(epoch FROM now() - query_start), 0)::float8
+	FROM pg_stat_activity
+	WHERE datname = current_database() AND pid <> pg_backend_pid() AND ($1 OR coalesce(state, '') <> 'idle')
+	ORDER BY query_start`, includeIdle)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ActivityRow, error) {
+		var activity ActivityRow
+		var seconds float64
+		if err := row.Scan(&activity.PID, &activity.State, &activity.Query, &seconds); err != nil {
+			return activity, err
+		}
+		activity.Duration = time.Duration(seconds * float64(time.Second))
+		return activity, nil
+	})
+}
+
+// ColumnInfo describes a table column as reported by information_schema.columns.
+type ColumnInfo struct {
+	Name     string  `db:"column_name"`
+	DataType string  `db:"data_type"` // e.g. "integer", "text", "ARRAY" or "USER-DEFINED"
+	UDTName  string  `db:"udt_name"`  // underlying type name, e.g. "int4", "_text" or an enum name
+	Nullable bool    `db:"is_nullable"`
+	Default  *string `db:"column_default"` // nil when the column has no default
+	Ordinal  int32   `db:"ordinal_position"`
+}
+
+// Columns returns the columns of table in schema, in table order. An empty schema means the current schema, usually public.
+// Only columns the current user has privileges on are listed; no columns are returned for a table that does not exist.
+func Columns(ctx context.Context, db Querier, schema, table string) ([]ColumnInfo, error) {
+	return Select[ColumnInfo](ctx, db, `SELECT column_name::text, data_type::text, udt_name::text, is_nullable = 'YES' AS is_nullable,
+		column_default::text, ordinal_position::int4
+	FROM information_schema.columns
+	WHERE table_schema = coalesce(nullif($1, ''), current_schema()) AND table_name = $2
+	ORDER BY ordinal_position`, schema, table)
+}
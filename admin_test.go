@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestBackendPID(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	want, err := Scalar[int32](ctx, conn, "SELECT pg_backend_pid()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := BackendPID(conn); got != want {
+		t.Errorf("BackendPID = %d, want %d", got, want)
+	}
+}
+
+func TestCancelBackend(t *testing.T) {
+	p := testPool(t, WithMaxConns(2))
+	ctx := testContext(t)
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Exec(ctx, "SELECT pg_sleep(30)")
+		done <- err
+	}()
+	// wait for the sleep to start, a cancel arriving before it would be lost
+	pid := BackendPID(conn)
+	for {
+		active, err := Exists(ctx, p, "SELECT EXISTS(SELECT 1 FROM pg_stat_activity WHERE pid = $1 AND state = 'active')", pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.CancelBackend(ctx, pid); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; sqlState(err) != "57014" {
+		t.Errorf("cancelled query returned %v, want query_canceled (57014)", err)
+	}
+	if err := conn.Ping(ctx); err != nil {
+		t.Errorf("connection unusable after cancelling its query: %v", err)
+	}
+}
+
+func TestTerminateBackend(t *testing.T) {
+	p := testPool(t, WithMaxConns(2))
+	ctx := testContext(t)
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if err := p.TerminateBackend(ctx, BackendPID(conn)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT 1"); err == nil {
+		t.Error("query on a terminated backend succeeded")
+	}
+}
+
+func TestSignalUnknownBackend(t *testing.T) {
+	p := testPool(t)
+	// PIDs are positive, so -1 never names a backend
+	err := p.CancelBackend(testContext(t), -1)
+	if err == nil || !strings.Contains(err.Error(), "was not signalled") {
+		t.Errorf("CancelBackend of an unknown PID returned %v, want a not signalled error", err)
+	}
+}
+
+func TestActiveQueries(t *testing.T) {
+	p := testPool(t, WithMaxConns(3))
+	ctx := testContext(t)
+	busy, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Release()
+	idle, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Release()
+	done := make(chan error, 1)
+	go func() {
+		_, err := busy.Exec(ctx, "SELECT pg_sleep(30)")
+		done <- err
+	}()
+	busyPID, idlePID := BackendPID(busy), BackendPID(idle)
+	var active []ActivityRow
+	for {
+		if active, err = p.ActiveQueries(ctx, false); err != nil {
+			t.Fatal(err)
+		}
+		if findActivity(active, busyPID) != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if row := findActivity(active, busyPID); row.State != "active" || !strings.Contains(row.Query, "pg_sleep") || row.Duration < 0 {
+		t.Errorf("sleeping backend reported as %+v", row)
+	}
+	if findActivity(active, idlePID) != nil {
+		t.Error("idle backend listed without includeIdle")
+	}
+	all, err := p.ActiveQueries(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := findActivity(all, idlePID); row == nil || row.State != "idle" {
+		t.Errorf("idle backend reported as %+v with includeIdle", row)
+	}
+	if err := p.CancelBackend(ctx, busyPID); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func findActivity(rows []ActivityRow, pid int32) *ActivityRow {
+	for i := range rows {
+		if rows[i].PID == pid {
+			return &rows[i]
+		}
+	}
+	return nil
+}
+
+func TestColumns(t *testing.T) {
+	schema := testName("test_columns")
+	testObject(t, "CREATE SCHEMA "+schema, "DROP SCHEMA "+schema+" CASCADE")
+	p := testPool(t)
+	ctx := testContext(t)
+	if _, err := p.Exec(ctx, "CREATE TABLE "+schema+".orders (id int4 NOT NULL DEFAULT 7, tags text[], note text)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exec(ctx, "ALTER TABLE "+schema+".orders DROP COLUMN tags"); err != nil {
+		t.Fatal(err)
+	}
+	columns, err := Columns(ctx, p, schema, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seven := "7"
+	want := []ColumnInfo{
+		{Name: "id", DataType: "integer", UDTName: "int4", Nullable: false, Default: &seven, Ordinal: 1},
+		{Name: "note", DataType: "text", UDTName: "text", Nullable: true, Ordinal: 3},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("Columns = %+v, want %+v", columns, want)
+	}
+	if columns, err := Columns(ctx, p, schema, "missing"); err != nil || len(columns) != 0 {
+		t.Errorf("Columns of a missing table = %+v, %v, want none", columns, err)
+	}
+	// An empty schema is the first of the search path, set on one connection.
+	err = p.Session(ctx, func(s *Session) error {
+		if _, err := s.Exec(ctx, "SET search_path TO "+schema); err != nil {
+			return err
+		}
+		defer s.Exec(ctx, "RESET search_path")
+		columns, err := Columns(ctx, s, "", "orders")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(columns, want) {
+			t.Errorf("Columns in the current schema = %+v, want %+v", columns, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsPrimaryOnServer(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	recovery, err := Scalar[bool](ctx, p, "SELECT pg_is_in_recovery()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary, err := p.IsPrimary(ctx); err != nil || primary == recovery {
+		t.Errorf("IsPrimary = %t, %v on a server with pg_is_in_recovery() %t", primary, err, recovery)
+	}
+}
+
+func TestIsPrimary(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	for _, primary := range []bool{true, false} {
+		server.answer("SELECT NOT pg_is_in_recovery()", []fakeColumn{{name: "?column?", oid: pgtype.BoolOID}}, []any{primary})
+		if got, err := p.IsPrimary(ctx); err != nil || got != primary {
+			t.Errorf("IsPrimary = %t, %v, want %t", got, err, primary)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// BatchCollector decodes the result of one queued query of a batch. Create it with Collect.
+type BatchCollector interface {
+	collect(br pgx.BatchResults) error
+}
+
+type collector[T any] struct {
+	dst *[]T
+}
+
+func (c collector[T]) collect(br pgx.BatchResults) error {
+	rows, err := br.Query()
+	if err != nil {
+		return err
+	}
+	result, err := pgx.CollectRows(rows, rowTo[T](false))
+	if err != nil {
+		return err
+	}
+	*c.dst = result
+	return nil
+}
+
+// Collect returns a BatchCollector storing the rows of a result into dst. Structs are mapped by column name, other types are scanned from a single column.
+func Collect[T any](dst *[]T) BatchCollector {
+	return collector[T]{dst: dst}
+}
+
+// CollectBatch decodes the results of br in queue order, one collector per queued query, and closes br.
+//
+//	var users []User
+//	var ids []int64
+//	err := CollectBatch(pool.SendBatch(ctx, batch), Collect(&users), Collect(&ids))
+func CollectBatch(br pgx.BatchResults, collectors ...BatchCollector) error {
+	defer br.Close()
+	for i, c := range collectors {
+		if err := c.collect(br); err != nil {
+			return fmt.Errorf("batch query %d: %w", i, err)
+		}
+	}
+	return br.Close()
+}
+
+// SendBatchMode is SendBatch running the queries of b with mode instead of the pool's default exec mode, e.g. the simple protocol
+// for a batch sent through a transaction pooler. When mode is the default the batch is sent as usual. Otherwise the queries run one
+// after another on one connection, each in a round trip of its own, and, unlike in a batch, each in its own implicit transaction,
+// so an error does not undo the queries before it: send the batch on a Tx when it must be atomic. Close releases the connection.
+func (p *Pool) SendBatchMode(ctx context.Context, b *pgx.Batch, mode pgx.QueryExecMode) pgx.BatchResults {
+	if mode == p.Config().ConnConfig.DefaultQueryExecMode {
+		return p.SendBatch(ctx, b)
+	}
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return &modeBatchResults{err: err, closed: true}
+	}
+	return &modeBatchResults{ctx: ctx, db: conn, release: conn.Release, mode: mode, b: b}
+}
+
+// SendBatchMode is Pool.SendBatchMode for the transaction. The queries always run one after another, see Pool.SendBatchMode.
+func (tx *Tx) SendBatchMode(ctx context.Context, b *pgx.Batch, mode pgx.QueryExecMode) pgx.BatchResults {
+	return &modeBatchResults{ctx: ctx, db: tx, mode: mode, b: b}
+}
+
+// modeBatchResults runs the queued queries of a batch one at a time as they are read.
+type modeBatchResults struct {
+	ctx     context.Context
+	db      Querier
+	release func()
+	mode    pgx.QueryExecMode
+	b       *pgx.Batch
+	next    int
+	rows    pgx.Rows
+	err     error
+	closed  bool
+}
+
+func (br *modeBatchResults) query() (*pgx.QueuedQuery, error) {
+	if br.err != nil {
+		return nil, br.err
+	}
+	if br.closed {
+		return nil, fmt.Errorf("batch already closed")
+	}
+	if br.rows != nil {
+		br.rows.Close()
+		br.rows = nil
+	}
+	if br.next >= len(br.b.QueuedQueries) {
+		return nil, fmt.Errorf("no more results in batch")
+	}
+	query := br.b.QueuedQueries[br.next]
+	br.next++
+	return query, nil
+}
+
+func (br *modeBatchResults) args(query *pgx.QueuedQuery) []any {
+	return append([]any{br.mode}, query.Arguments...)
+}
+
+func (br *modeBatchResults) Exec() (pgconn.CommandTag, error) {
+	query, err := br.query()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return br.db.Exec(br.ctx, query.SQL, br.args(query)...)
+}
+
+func (br *modeBatchResults) Query() (pgx.Rows, error) {
+	query, err := br.query()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := br.db.Query(br.ctx, query.SQL, br.args(query)...)
+	if err != nil {
+		return nil, err
+	}
+	br.rows = rows
+	return rows, nil
+}
+
+func (br *modeBatchResults) QueryRow() pgx.Row {
+	query, err := br.query()
+	if err != nil {
+		return errorRow{err: err}
+	}
+	return br.db.QueryRow(br.ctx, query.SQL, br.args(query)...)
+}
+
+func (br *modeBatchResults) Close() error {
+	if br.closed {
+		return br.err
+	}
+	for br.err == nil && br.next < len(br.b.QueuedQueries) {
+		if fn := br.b.QueuedQueries[br.next].Fn; fn != nil {
+			br.err = fn(br)
+		} else if _, err := br.Exec(); err != nil {
+			br.err = err
+		}
+	}
+	if br.rows != nil {
+		br.rows.Close()
+		br.rows = nil
+	}
+	br.closed = true
+	if br.release != nil {
+		br.release()
+	}
+	return br.err
+}
+
+type errorRow struct {
+	err error
+}
+
+func (r errorRow) Scan(...any) error {
+	return r.err
+}
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// failingBatchResults is a pgx.BatchResults whose queries all fail, counting how often it is closed.
+type failingBatchResults struct {
+	err    error
+	closed int
+}
+
+func (br *failingBatchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, br.err }
+func (br *failingBatchResults) Query() (pgx.Rows, error)         { return nil, br.err }
+func (br *failingBatchResults) QueryRow() pgx.Row                { return failedRow{err: br.err} }
+func (br *failingBatchResults) Close() error {
+	br.closed++
+	return nil
+}
+
+func TestCollectBatchFailure(t *testing.T) {
+	failed := errors.New("query failed")
+	br := &failingBatchResults{err: failed}
+	var ids []int
+	err := CollectBatch(br, Collect(&ids))
+	if !errors.Is(err, failed) || !strings.Contains(err.Error(), "batch query 0") {
+		t.Errorf("CollectBatch returned %v, want the query error for batch query 0", err)
+	}
+	if br.closed == 0 {
+		t.Error("CollectBatch did not close the batch results")
+	}
+}
+
+type testUser struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestCollectBatch(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1::int8 AS id, 'ann' AS name UNION ALL SELECT 2, 'bob' ORDER BY id")
+	batch.Queue("SELECT generate_series(1, $1::int)", 3)
+	batch.Queue("SELECT 'x' WHERE false")
+	var users []testUser
+	var numbers []int
+	var empty []string
+	if err := CollectBatch(p.SendBatch(ctx, batch), Collect(&users), Collect(&numbers), Collect(&empty)); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[1] != (testUser{2, "bob"}) {
+		t.Errorf("users = %+v", users)
+	}
+	if len(numbers) != 3 || numbers[2] != 3 {
+		t.Errorf("numbers = %v, want [1 2 3]", numbers)
+	}
+	if len(empty) != 0 {
+		t.Errorf("empty result collected %v", empty)
+	}
+}
+
+func TestCollectBatchQueryError(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1")
+	batch.Queue("SELECT 1/0")
+	var first, second []int
+	err := CollectBatch(p.SendBatch(ctx, batch), Collect(&first), Collect(&second))
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "22012" || !strings.Contains(err.Error(), "batch query 1") {
+		t.Errorf("CollectBatch returned %v, want division_by_zero from batch query 1", err)
+	}
+}
+
+func TestSendBatchMode(t *testing.T) {
+	server := newAcceptingServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := New(ctx, WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	server.answer("SELECT  '7' ::int", []fakeColumn{{name: "int4", oid: pgtype.Int4OID}}, []any{7})
+	drainQueries(server)
+	var n int
+	b := &pgx.Batch{}
+	b.Queue("SELECT $1::int", 7).QueryRow(func(row pgx.Row) error { return row.Scan(&n) })
+	b.Queue("SELECT 2")
+	// The simple protocol interpolates the argument, so the server sees which mode the batch used.
+	if err := p.SendBatchMode(ctx, b, pgx.QueryExecModeSimpleProtocol).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Errorf("queued query scanned %d, want 7", n)
+	}
+	if got, want := drainQueries(server), []string{"SELECT  '7' ::int", "SELECT 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+	if acquired := p.Stat().AcquiredConns(); acquired != 0 {
+		t.Errorf("%d connections still acquired after Close, want 0", acquired)
+	}
+	b = &pgx.Batch{}
+	b.Queue("SELECT $1::int", 7)
+	if err := p.SendBatchMode(ctx, b, pgx.QueryExecModeCacheStatement).Close(); err == nil {
+		t.Error("batch in the default mode succeeded, want the server's refusal to prepare")
+	}
+	if got := drainQueries(server); len(got) == 0 || got[0] != "SELECT $1::int" {
+		t.Errorf("server received %q in the default mode, want the statement prepared", got)
+	}
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryBuilder numbers the positional parameters of a query assembled from optional conditions. It only does the placeholder
+// bookkeeping: the SQL fragments are added verbatim, so they must never contain user input, which belongs in the arguments.
+type QueryBuilder struct {
+	base       string
+	conditions []string
+	args       []any
+	err        error
+}
+
+// NewQuery starts a query with base, e.g. "SELECT * FROM users", whose own parameters, if any, are $1 to $len(args).
+func NewQuery(base string, args ...any) *QueryBuilder {
+	return &QueryBuilder{base: base, args: args}
+}
+
+// Arg adds value as the next parameter and returns its placeholder, e.g. "$3", for use in a condition.
+func (b *QueryBuilder) Arg(value any) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// Where adds condition, e.g. "created_at >= "+b.Arg(since). Conditions are joined with AND, so parenthesize ones using OR.
+func (b *QueryBuilder) Where(condition string) *QueryBuilder {
+	b.conditions = append(b.conditions, condition)
+	return b
+}
+
+// Eq adds the condition column = value, or column IS NULL when value is nil. column may be qualified, e.g. "u.id" or "s.users.id".
+func (b *QueryBuilder) Eq(column string, value any) *QueryBuilder {
+	quoted := b.quote(column)
+	if value == nil {
+		return b.Where(quoted + " IS NULL")
+	}
+	return b.Where(quoted + " = " + b.Arg(value))
+}
+
+// In adds the condition column IN (...) with one parameter per value. A nil value matches NULL, which IN alone never does,
+// and an empty values matches no rows.
+func (b *QueryBuilder) In(column string, values ...any) *QueryBuilder {
+	quoted := b.quote(column)
+	var placeholders []string
+	var null bool
+	for _, value := range values {
+		if value == nil {
+			null = true
+			continue
+		}
+		placeholders = append(placeholders, b.Arg(value))
+	}
+	switch {
+	case len(placeholders) == 0 && null:
+		return b.Where(quoted + " IS NULL")
+	case len(placeholders) == 0:
+		return b.Where("false")
+	case null:
+		return b.Where("(" + quoted + " IN (" + strings.Join(placeholders, ", ") + ") OR " + quoted + " IS NULL)")
+	default:
+		return b.Where(quoted + " IN (" + strings.Join(placeholders, ", ") + ")")
+	}
+}
+
+// Build returns the query with its conditions, if any, in a WHERE clause, and the arguments in placeholder order.
+// Further clauses such as ORDER BY can be appended to the returned SQL, using Arg before Build for their parameters.
+// It fails if a column name passed to Eq or In is not a valid identifier.
+func (b *QueryBuilder) Build() (string, []any, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	sql := b.base
+	if len(b.conditions) > 0 {
+		sql += " WHERE " + strings.Join(b.conditions, " AND ")
+	}
+	return sql, b.args, nil
+}
+
+// quote quotes a column name, which may be qualified, keeping the first error for Build.
+func (b *QueryBuilder) quote(column string) string {
+	quoted, err := quoteColumn(column)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return quoted
+}
+
+// quoteColumn quotes a "column", "table.column" or "schema.table.column" reference, each part with quoteIdent.
+func quoteColumn(column string) (string, error) {
+	parts := strings.Split(column, ".")
+	if len(parts) > 3 {
+		return "", fmt.Errorf("column reference %q has more than three parts", column)
+	}
+	for i, part := range parts {
+		var err error
+		if parts[i], err = quoteIdent(part); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryBuilderPlaceholders(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewQuery("SELECT * FROM users_of($1) u", 7)
+	b.Where("created_at >= "+b.Arg(since)).Eq("u.status", "active").In("role", "admin", "owner")
+	sql, args, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT * FROM users_of($1) u WHERE created_at >= $2 AND "u"."status" = $3 AND "role" IN ($4, $5)`
+	if sql != want {
+		t.Errorf("sql = %s, want %s", sql, want)
+	}
+	if wantArgs := []any{7, since, "active", "admin", "owner"}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestQueryBuilderWithoutConditions(t *testing.T) {
+	sql, args, err := NewQuery("SELECT 1").Build()
+	if err != nil || sql != "SELECT 1" || len(args) != 0 {
+		t.Errorf("Build = %q, %v, %v, want the base unchanged", sql, args, err)
+	}
+}
+
+func TestQueryBuilderNil(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *QueryBuilder)
+		sql   string
+		args  []any
+	}{
+		{"eq nil", func(b *QueryBuilder) { b.Eq("deleted_at", nil) }, `"deleted_at" IS NULL`, nil},
+		{"in empty", func(b *QueryBuilder) { b.In("id") }, `false`, nil},
+		{"in only nil", func(b *QueryBuilder) { b.In("id", nil) }, `"id" IS NULL`, nil},
+		{"in with nil", func(b *QueryBuilder) { b.In("id", 1, nil, 2) }, `("id" IN ($1, $2) OR "id" IS NULL)`, []any{1, 2}},
+	}
+	for _, tt := range tests {
+		b := NewQuery("SELECT * FROM t")
+		tt.build(b)
+		sql, args, err := b.Build()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if want := "SELECT * FROM t WHERE " + tt.sql; sql != want {
+			t.Errorf("%s: sql = %s, want %s", tt.name, sql, want)
+		}
+		if len(args) != len(tt.args) || len(args) > 0 && !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: args = %v, want %v", tt.name, args, tt.args)
+		}
+	}
+}
+
+func TestQueryBuilderInvalidColumn(t *testing.T) {
+	for _, column := range []string{"", "a.b.c.d", "bad\x00name"} {
+		b := NewQuery("SELECT * FROM t").Eq("id", 1).In(column, 1)
+		if _, _, err := b.Build(); err == nil {
+			t.Errorf("Build accepted the column %q", column)
+		}
+	}
+}
+
+func TestQueryBuilderAgainstServer(t *testing.T) {
+	table := testTable(t, "test_builder", "id int, note text")
+	p := testPool(t)
+	ctx := testContext(t)
+	if _, err := p.Exec(ctx, "INSERT INTO "+table+" VALUES (1, 'a'), (2, NULL), (3, 'c')"); err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := NewQuery("SELECT count(*) FROM "+table).In("note", "a", nil).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Scalar[int](ctx, p, sql, args...)
+	if err != nil || n != 2 {
+		t.Errorf("%s matched %d rows, %v, want 2", sql, n, err)
+	}
+}
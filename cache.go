@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryCache enables CachedGet, which memoizes results for ttl keyed by result type, SQL and arguments, holding at most maxEntries results.
+// Cached results may be up to ttl stale: writes made through the pool are not detected, call InvalidateCache after changing cached data.
+// Only use it for reference data that is read often and changes rarely.
+func WithQueryCache(ttl time.Duration, maxEntries int) Option {
+	return func(options *options) error {
+		if ttl <= 0 {
+			return fmt.Errorf("query cache ttl must be greater than zero")
+		}
+		if maxEntries <= 0 {
+			return fmt.Errorf("query cache max entries must be greater than zero")
+		}
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			p.cache = newQueryCache(ttl, maxEntries)
+			return nil
+		})
+		return nil
+	}
+}
+
+// CachedGet is Get served from the query cache. Without WithQueryCache it behaves exactly like Get. Errors are never cached.
+// Cached values are shared between callers and must not be modified. Arguments are keyed by the values they point to,
+// so pointer arguments are safe; maps, channels and functions cannot be keyed and are rejected.
+func CachedGet[T any](ctx context.Context, p *Pool, sql string, args ...any) (T, error) {
+	if p.cache == nil {
+		return Get[T](ctx, p, sql, args...)
+	}
+	var zero T
+	key, err := cacheKey(reflect.TypeOf((*T)(nil)).Elem(), sql, args)
+	if err != nil {
+		return zero, err
+	}
+	if value, ok := p.cache.get(key); ok {
+		cached, _ := value.(T) // a nil cached for an interface T fails the assertion and is the zero T
+		return cached, nil
+	}
+	value, err := Get[T](ctx, p, sql, args...)
+	if err != nil {
+		return zero, err
+	}
+	p.cache.set(key, value)
+	return value, nil
+}
+
+// cacheKey identifies a query by its result type, SQL and the values of its arguments.
+func cacheKey(result reflect.Type, sql string, args []any) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s", result, sql)
+	for _, arg := range args {
+		b.WriteByte(0)
+		if err := writeCacheKey(&b, reflect.ValueOf(arg), 0); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// max_cache_key_depth bounds the nesting writeCacheKey follows, which also stops on cyclic pointers.
+const max_cache_key_depth = 16
+
+// writeCacheKey writes v to b by value, following pointers and interfaces instead of printing their addresses.
+func writeCacheKey(b *strings.Builder, v reflect.Value, depth int) error {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return nil
+	}
+	if depth > max_cache_key_depth {
+		return fmt.Errorf("query cache: argument of type %s is nested too deeply", v.Type())
+	}
+	b.WriteString(v.Type().String())
+	b.WriteByte('(')
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+		} else if err := writeCacheKey(b, v.Elem(), depth+1); err != nil {
+			return err
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			b.WriteString("nil")
+			break
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			for i := 0; i < v.Len(); i++ {
+				fmt.Fprintf(b, "%02x", v.Index(i).Uint())
+			}
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCacheKey(b, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if v.Type() == timeType && v.CanInterface() {
+			t := v.Interface().(time.Time)
+			b.WriteString(t.Format(time.RFC3339Nano) + " " + t.Location().String())
+			break
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCacheKey(b, v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("query cache: cannot key argument of type %s", v.Type())
+	default:
+		fmt.Fprintf(b, "%#v", v)
+	}
+	b.WriteByte(')')
+	return nil
+}
+
+// InvalidateCache drops all results cached by CachedGet.
+func (p *Pool) InvalidateCache() {
+	if p.cache != nil {
+		p.cache.clear()
+	}
+}
+
+type queryCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	recent  list.List // most recently used first
+}
+
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func newQueryCache(ttl time.Duration, maxEntries int) *queryCache {
+	return &queryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *queryCache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.recent.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.recent.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *queryCache) set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.recent.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	for c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *queryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.recent.Init()
+}
@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestQueryCacheHitMissExpiry(t *testing.T) {
+	c := newQueryCache(50*time.Millisecond, 10)
+	if _, ok := c.get("a"); ok {
+		t.Fatal("empty cache returned a hit")
+	}
+	c.set("a", 1)
+	if value, ok := c.get("a"); !ok || value != 1 {
+		t.Fatalf("get(a) = %v, %v, want 1, true", value, ok)
+	}
+	if _, ok := c.get("b"); ok {
+		t.Fatal("get(b) hit a key that was never set")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.get("a"); ok {
+		t.Fatal("get(a) hit after the ttl expired")
+	}
+	if len(c.entries) != 0 || c.recent.Len() != 0 {
+		t.Fatalf("expired entry was not removed: %d entries, %d in list", len(c.entries), c.recent.Len())
+	}
+}
+
+func TestQueryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newQueryCache(time.Minute, 2)
+	c.set("a", 1)
+	c.set("b", 2)
+	c.get("a") // b is now the least recently used
+	c.set("c", 3)
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used entry b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+}
+
+func TestQueryCacheSetReplacesAndClear(t *testing.T) {
+	c := newQueryCache(time.Minute, 2)
+	c.set("a", 1)
+	c.set("a", 2)
+	if value, _ := c.get("a"); value != 2 {
+		t.Errorf("get(a) = %v after replacing it, want 2", value)
+	}
+	if c.recent.Len() != 1 {
+		t.Errorf("replacing a key left %d entries, want 1", c.recent.Len())
+	}
+	c.clear()
+	if _, ok := c.get("a"); ok {
+		t.Error("get(a) hit after clear")
+	}
+}
+
+func TestCacheKeyDereferencesPointers(t *testing.T) {
+	one, two := 1, 2
+	keyOne, err := cacheKey(reflect.TypeOf(0), "SELECT $1", []any{&one})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyTwo, err := cacheKey(reflect.TypeOf(0), "SELECT $1", []any{&two})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyOne == keyTwo {
+		t.Error("pointers to different values produced the same key")
+	}
+	other := 1
+	keyOther, err := cacheKey(reflect.TypeOf(0), "SELECT $1", []any{&other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyOne != keyOther {
+		t.Errorf("pointers to equal values produced different keys %q and %q", keyOne, keyOther)
+	}
+	two = 1
+	if keyTwo, _ = cacheKey(reflect.TypeOf(0), "SELECT $1", []any{&two}); keyTwo != keyOne {
+		t.Error("key did not follow the value the pointer points to")
+	}
+}
+
+func TestCacheKeyDistinguishes(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		result any
+		sql    string
+		a, b   []any
+	}{
+		{"values", 0, "SELECT $1", []any{1}, []any{2}},
+		{"types", 0, "SELECT $1", []any{int32(1)}, []any{int64(1)}},
+		{"strings", 0, "SELECT $1, $2", []any{"a,b", "c"}, []any{"a", "b,c"}},
+		{"nil and zero", 0, "SELECT $1", []any{nil}, []any{0}},
+		{"nil pointer", 0, "SELECT $1", []any{(*int)(nil)}, []any{new(int)}},
+		{"bytes", 0, "SELECT $1", []any{[]byte{1, 2}}, []any{[]byte{1, 3}}},
+		{"slices", 0, "SELECT $1", []any{[]string{"a"}}, []any{[]string{"a", "b"}}},
+		{"times", 0, "SELECT $1", []any{at}, []any{at.Add(time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := cacheKey(reflect.TypeOf(tt.result), tt.sql, tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := cacheKey(reflect.TypeOf(tt.result), tt.sql, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a == b {
+				t.Errorf("both produced the key %q", a)
+			}
+		})
+	}
+	a, _ := cacheKey(reflect.TypeOf(int64(0)), "SELECT 1", nil)
+	if b, _ := cacheKey(reflect.TypeOf(""), "SELECT 1", nil); a == b {
+		t.Error("different result types produced the same key")
+	}
+	if b, _ := cacheKey(reflect.TypeOf(int64(0)), "SELECT 2", nil); a == b {
+		t.Error("different SQL produced the same key")
+	}
+	a, _ = cacheKey(reflect.TypeOf((*any)(nil)).Elem(), "SELECT 1", nil)
+	if b, _ := cacheKey(reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), "SELECT 1", nil); a == b {
+		t.Error("different interface result types produced the same key")
+	}
+}
+
+func TestCacheKeyRejectsUnkeyableArguments(t *testing.T) {
+	for _, arg := range []any{map[string]int{"a": 1}, make(chan int), func() {}} {
+		if _, err := cacheKey(reflect.TypeOf(0), "SELECT $1", []any{arg}); err == nil || !strings.Contains(err.Error(), "cannot key") {
+			t.Errorf("cacheKey(%T) error = %v, want a cannot key error", arg, err)
+		}
+	}
+	type node struct{ next *node }
+	cycle := &node{}
+	cycle.next = cycle
+	if _, err := cacheKey(reflect.TypeOf(0), "SELECT $1", []any{cycle}); err == nil {
+		t.Error("cacheKey accepted a cyclic pointer")
+	}
+}
+
+func TestCachedGetInterfaceTypes(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server, WithQueryCache(time.Minute, 10))
+	ctx := testContext(t)
+	server.answer("SELECT 1", []fakeColumn{{name: "n", oid: pgtype.Int8OID}}, []any{int64(1)})
+	if value, err := CachedGet[any](ctx, p, "SELECT 1"); err != nil || value != int64(1) {
+		t.Fatalf("CachedGet[any] = %v, %v, want 1", value, err)
+	}
+	// a hit on the entry of CachedGet[any] would make the assertion to fmt.Stringer panic
+	if _, err := CachedGet[fmt.Stringer](ctx, p, "SELECT 1"); err == nil {
+		t.Error("CachedGet[fmt.Stringer] scanned an int8 without error")
+	}
+}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// CredentialProvider returns the user and password to connect with.
+type CredentialProvider func(ctx context.Context) (user, pass string, err error)
+
+// CredentialProvider is called before every new connection and overrides the user and password options. Use it with rotating credentials.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(options *options) error {
+		if provider == nil {
+			return fmt.Errorf("credential provider cannot be nil")
+		}
+		options.credentials = provider
+		return nil
+	}
+}
+
+// CredentialRefresh calls the credential provider every interval in the background and connects with the cached result,
+// so new connections do not wait for the provider. Until the provider has succeeded once,
+// it is called on connect instead. Refresh errors are logged and the previous credentials are kept. Stopped by Close.
+func WithCredentialRefresh(interval time.Duration) Option {
+	return func(options *options) error {
+		if interval <= 0 {
+			return fmt.Errorf("credential refresh interval must be greater than zero")
+		}
+		options.credentialrefresh = interval
+		return nil
+	}
+}
+
+// applyCredentials registers the hooks of the credential options.
+func applyCredentials(opt *options) error {
+	provider := opt.credentials
+	if provider == nil {
+		if opt.credentialrefresh > 0 {
+			return fmt.Errorf("credential refresh requires a credential provider")
+		}
+		return nil
+	}
+	if interval := opt.credentialrefresh; interval > 0 {
+		cache := &credentialCache{provider: provider}
+		provider = cache.get
+		opt.onnew = append(opt.onnew, func(p *Pool) error {
+			p.credentials = cache
+			p.goBackground(func(ctx context.Context) {
+				cache.refreshEvery(ctx, p, interval)
+			})
+			return nil
+		})
+	}
+	opt.beforeconnect = append(opt.beforeconnect, func(ctx context.Context, config *pgx.ConnConfig) error {
+		user, pass, err := provider(ctx)
+		if err != nil {
+			return fmt.Errorf("credential provider: %w", err)
+		}
+		config.User = user
+		config.Password = pass
+		return nil
+	})
+	return nil
+}
+
+type credentialCache struct {
+	provider CredentialProvider
+
+	mu     sync.RWMutex
+	loaded bool
+	user   string
+	pass   string
+}
+
+func (c *credentialCache) get(ctx context.Context) (string, string, error) {
+	c.mu.RLock()
+	if c.loaded {
+		defer c.mu.RUnlock()
+		return c.user, c.pass, nil
+	}
+	c.mu.RUnlock()
+	return c.refresh(ctx)
+}
+
+func (c *credentialCache) refresh(ctx context.Context) (string, string, error) {
+	user, pass, err := c.provider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	c.mu.Lock()
+	c.loaded, c.user, c.pass = true, user, pass
+	c.mu.Unlock()
+	return user, pass, nil
+}
+
+func (c *credentialCache) refreshEvery(ctx context.Context, p *Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, _, err := c.refresh(ctx); err != nil && ctx.Err() == nil {
+				p.log(ctx, tracelog.LogLevelWarn, "refresh credentials", map[string]any{"err": err})
+			}
+		}
+	}
+}
+
+// ResetAndPing closes all connections so that new ones are dialed, picking up rotated credentials from the credential provider.
+// With WithCredentialRefresh the cached credentials are refreshed first, so the new connections do not reuse stale ones.
+// Idle connections are closed immediately, connections in use are closed when released, so in-flight work is not interrupted.
+// It is a softer alternative to recreating the pool. ResetAndPing returns once a fresh connection has been established.
+// It does not shadow pgxpool.Pool.Reset, which closes the connections without waiting.
+func (p *Pool) ResetAndPing(ctx context.Context) error {
+	if p.credentials != nil {
+		if _, _, err := p.credentials.refresh(ctx); err != nil {
+			return fmt.Errorf("credential provider: %w", err)
+		}
+	}
+	p.Pool.Reset()
+	return p.Ping(ctx)
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// countingProvider is a CredentialProvider returning the user "user<n>" on its nth call, or err once set.
+type countingProvider struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (c *countingProvider) provide(context.Context) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return "", "", c.err
+	}
+	c.calls++
+	return "user" + strconv.Itoa(c.calls), "secret", nil
+}
+
+func (c *countingProvider) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func (c *countingProvider) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func TestCredentialOptionsValidate(t *testing.T) {
+	if err := WithCredentialProvider(nil)(&options{}); err == nil {
+		t.Error("WithCredentialProvider accepted nil")
+	}
+	if err := WithCredentialRefresh(0)(&options{}); err == nil {
+		t.Error("WithCredentialRefresh accepted a zero interval")
+	}
+	if _, err := New(context.Background(), WithCredentialRefresh(time.Minute)); err == nil {
+		t.Error("New accepted WithCredentialRefresh without a provider")
+	}
+}
+
+func TestCredentialRefreshSchedule(t *testing.T) {
+	server := newAcceptingServer(t)
+	core, observed := observer.New(zapcore.WarnLevel)
+	provider := &countingProvider{}
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithCredentialProvider(provider.provide), WithCredentialRefresh(20*time.Millisecond), WithZapLogger(zap.New(core), "warn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if user := (<-server.startups).params["user"]; user != "user1" {
+		t.Errorf("first connection logged in as %q, want user1 from the provider", user)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for provider.count() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := provider.count(); n < 4 {
+		t.Fatalf("provider called %d times, want it refreshed in the background", n)
+	}
+	// A failing refresh is logged and the last credentials stay in use.
+	provider.fail(errors.New("vault unavailable"))
+	called := provider.count()
+	for observed.FilterMessage("refresh credentials").Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if observed.FilterMessage("refresh credentials").Len() == 0 {
+		t.Fatal("no warning for the failed refresh")
+	}
+	p.Pool.Reset()
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if user, want := (<-server.startups).params["user"], "user"+strconv.Itoa(called); user != want {
+		t.Errorf("new connection logged in as %q, want the cached %s", user, want)
+	}
+}
+
+func TestCredentialRefreshConnectsWithCache(t *testing.T) {
+	server := newAcceptingServer(t)
+	provider := &countingProvider{}
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithCredentialProvider(provider.provide), WithCredentialRefresh(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	<-server.startups
+	for i := 0; i < 3; i++ {
+		p.Pool.Reset()
+		if err := p.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if user := (<-server.startups).params["user"]; user != "user1" {
+			t.Errorf("connection %d logged in as %q, want the cached user1", i+2, user)
+		}
+	}
+	if n := provider.count(); n != 1 {
+		t.Errorf("provider called %d times, want once since the cache is loaded", n)
+	}
+}
+
+func TestResetAndPingCallsProvider(t *testing.T) {
+	for _, refresh := range []bool{false, true} {
+		server := newAcceptingServer(t)
+		provider := &countingProvider{}
+		opts := []Option{WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithCredentialProvider(provider.provide)}
+		if refresh {
+			opts = append(opts, WithCredentialRefresh(time.Hour))
+		}
+		p, err := New(context.Background(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		<-server.startups
+		if err := p.ResetAndPing(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if n := provider.count(); n != 2 {
+			t.Errorf("refresh %v: provider called %d times after ResetAndPing, want 2", refresh, n)
+		}
+		if user := (<-server.startups).params["user"]; user != "user2" {
+			t.Errorf("refresh %v: connection after ResetAndPing logged in as %q, want the new user2", refresh, user)
+		}
+		provider.fail(errors.New("vault unavailable"))
+		if err := p.ResetAndPing(context.Background()); err == nil {
+			t.Errorf("refresh %v: ResetAndPing succeeded with a failing provider", refresh)
+		}
+	}
+}
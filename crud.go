@@ -0,0 +1,357 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Conflict is the conflict target of Upsert. Create it with OnConflictColumns or OnConflictConstraint.
+type Conflict struct {
+	columns    []string
+	where      string
+	constraint string
+}
+
+// OnConflictColumns targets the unique index over columns, e.g. a composite primary key.
+func OnConflictColumns(columns ...string) Conflict {
+	return Conflict{columns: columns}
+}
+
+// OnConflictConstraint targets the named unique or exclusion constraint (ON CONFLICT ON CONSTRAINT name).
+func OnConflictConstraint(name string) Conflict {
+	return Conflict{constraint: name}
+}
+
+// Where sets the predicate of a partial unique index targeted by OnConflictColumns. predicate is added to the SQL verbatim.
+func (c Conflict) Where(predicate string) Conflict {
+	c.where = predicate
+	return c
+}
+
+func (c Conflict) clause() (string, error) {
+	switch {
+	case c.constraint != "" && len(c.columns) > 0:
+		return "", fmt.Errorf("conflict target cannot have both columns and a constraint")
+	case c.constraint != "":
+		constraint, err := quoteIdent(c.constraint)
+		if err != nil {
+			return "", err
+		}
+		return "ON CONFLICT ON CONSTRAINT " + constraint, nil
+	case len(c.columns) > 0:
+		columns, err := quoteIdents(c.columns)
+		if err != nil {
+			return "", err
+		}
+		clause := "ON CONFLICT (" + columns + ")"
+		if c.where != "" {
+			clause += " WHERE " + c.where
+		}
+		return clause, nil
+	default:
+		return "", fmt.Errorf("conflict target cannot be empty")
+	}
+}
+
+// Insert inserts row, a struct or pointer to struct, into table, which may be schema-qualified ("schema.table"). Columns are named by the db tag or the lowercased field name; fields tagged db:"-" are skipped.
+func Insert(ctx context.Context, db Querier, table string, row any) (pgconn.CommandTag, error) {
+	sql, args, err := insertSQL(table, row)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	sql, args = configOf(db).prepare(ctx, sql, args)
+	return db.Exec(ctx, sql, args...)
+}
+
+// Upsert inserts row like Insert and, when it conflicts with conflict, updates the existing row with the inserted values.
+// With OnConflictColumns the conflict columns themselves are not updated; if no other column remains the conflicting row is left as is.
+func Upsert(ctx context.Context, db Querier, table string, conflict Conflict, row any) (pgconn.CommandTag, error) {
+	sql, args, err := insertSQL(table, row)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	clause, err := conflict.clause()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	columns, _, err := structColumns(row)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	skip := make(map[string]bool, len(conflict.columns))
+	for _, column := range conflict.columns {
+		skip[column] = true
+	}
+	var set []string
+	for _, column := range columns {
+		if !skip[column] {
+			quoted, err := quoteIdent(column)
+			if err != nil {
+				return pgconn.CommandTag{}, err
+			}
+			set = append(set, quoted+" = EXCLUDED."+quoted)
+		}
+	}
+	if len(set) == 0 {
+		sql += " " + clause + " DO NOTHING"
+	} else {
+		sql += " " + clause + " DO UPDATE SET " + strings.Join(set, ", ")
+	}
+	sql, args = configOf(db).prepare(ctx, sql, args)
+	return db.Exec(ctx, sql, args...)
+}
+
+// InsertReturning runs an INSERT ... RETURNING statement and scans the returned row into T, a struct mapped by column name or a single-column type.
+// ErrNoRows is returned if no row was inserted, e.g. with ON CONFLICT DO NOTHING.
+func InsertReturning[T any](ctx context.Context, db Querier, sql string, args ...any) (T, error) {
+	return Get[T](ctx, db, sql, args...)
+}
+
+// GetOrCreate returns the row inserted by insertSQL, an INSERT ... ON CONFLICT DO NOTHING RETURNING statement, and true,
+// or, when it inserted nothing, the existing row returned by selectSQL and false. Both statements take args and run in one
+// transaction, so a row inserted concurrently by another caller is found by selectSQL once that caller has committed.
+func GetOrCreate[T any](ctx context.Context, p *Pool, insertSQL string, selectSQL string, args ...any) (T, bool, error) {
+	var row T
+	var created bool
+	err := p.WithTx(ctx, func(tx *Tx) error {
+		var err error
+		row, err = Get[T](ctx, tx, insertSQL, args...)
+		created = err == nil
+		if created {
+			return nil
+		}
+		if !errors.Is(err, ErrNoRows) {
+			return err
+		}
+		row, err = Get[T](ctx, tx, selectSQL, args...)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	return row, created, nil
+}
+
+// ErrVersionConflict is returned by UpdateIfVersion when the row does not have the expected version, or no longer exists.
+var ErrVersionConflict = errors.New("postgres: row version conflict")
+
+// UpdateIfVersion sets the columns in set of the row of table whose id column is id, provided its version column still equals
+// expectedVersion, and increments version, implementing optimistic locking. ErrVersionConflict is returned when no row was updated,
+// i.e. the row was changed or deleted since it was read; reread it and retry. Column names are quoted; id and version cannot be set.
+func UpdateIfVersion(ctx context.Context, db Querier, table string, id any, expectedVersion int, set map[string]any) error {
+	if len(set) == 0 {
+		return fmt.Errorf("set cannot be empty")
+	}
+	columns := make([]string, 0, len(set))
+	for column := range set {
+		if column == "id" || column == "version" {
+			return fmt.Errorf("column %s cannot be set", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	assignments := make([]string, len(columns))
+	args := make([]any, 0, len(columns)+2)
+	for i, column := range columns {
+		quoted, err := quoteIdent(column)
+		if err != nil {
+			return err
+		}
+		args = append(args, set[column])
+		assignments[i] = quoted + " = $" + strconv.Itoa(len(args))
+	}
+	args = append(args, id, expectedVersion)
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return err
+	}
+	sql := "UPDATE " + quotedTable + " SET " + strings.Join(assignments, ", ") + `, "version" = "version" + 1` +
+		` WHERE "id" = $` + strconv.Itoa(len(args)-1) + ` AND "version" = $` + strconv.Itoa(len(args))
+	sql, args = configOf(db).prepare(ctx, sql, args)
+	tag, err := db.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// SelectByCompositeKeys selects the rows of table whose keyCols match one of keys, using WHERE (c1, c2) IN (($1, $2), ...),
+// and maps them into T like Select. Every key must have one value per key column. No query is run for empty keys.
+func SelectByCompositeKeys[T any](ctx context.Context, db Querier, table string, keyCols []string, keys [][]any) ([]T, error) {
+	if len(keyCols) == 0 {
+		return nil, fmt.Errorf("key columns cannot be empty")
+	}
+	if len(keys) == 0 {
+		return []T{}, nil
+	}
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return nil, err
+	}
+	quotedCols, err := quoteIdents(keyCols)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]any, 0, len(keys)*len(keyCols))
+	tuples := make([]string, len(keys))
+	placeholders := make([]string, len(keyCols))
+	for i, key := range keys {
+		if len(key) != len(keyCols) {
+			return nil, fmt.Errorf("key %d has %d values, expected %d", i, len(key), len(keyCols))
+		}
+		for j, value := range key {
+			args = append(args, value)
+			placeholders[j] = "$" + strconv.Itoa(len(args))
+		}
+		tuples[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	sql := "SELECT * FROM " + quotedTable + " WHERE (" + quotedCols + ") IN (" + strings.Join(tuples, ", ") + ")"
+	return Select[T](ctx, db, sql, args...)
+}
+
+// CopyInsertFunc bulk-loads rows produced by next into table with COPY, keeping memory bounded for generated or streamed rows.
+// next returns the values of the next row in columns order and false once there are no more rows. If next returns an error
+// the COPY is aborted, nothing is inserted and the error is returned.
+func CopyInsertFunc(ctx context.Context, db Querier, table string, columns []string, next func() ([]any, bool, error)) (int64, error) {
+	if _, err := quoteTable(table); err != nil {
+		return 0, err
+	}
+	if _, err := quoteIdents(columns); err != nil {
+		return 0, err
+	}
+	return db.CopyFrom(ctx, tableIdentifier(table), columns, pgx.CopyFromFunc(func() ([]any, error) {
+		row, ok, err := next()
+		if err != nil || !ok {
+			return nil, err
+		}
+		return row, nil
+	}))
+}
+
+func insertSQL(table string, row any) (string, []any, error) {
+	columns, values, err := structColumns(row)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("%T has no columns to insert", row)
+	}
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return "", nil, err
+	}
+	quotedCols, err := quoteIdents(columns)
+	if err != nil {
+		return "", nil, err
+	}
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+	sql := "INSERT INTO " + quotedTable + " (" + quotedCols + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	return sql, values, nil
+}
+
+// structColumns returns the column names and values of the exported fields of a struct, flattening embedded structs.
+func structColumns(row any) ([]string, []any, error) {
+	v := reflect.ValueOf(row)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil, fmt.Errorf("row cannot be nil")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("row must be a struct, got %T", row)
+	}
+	var columns []string
+	var values []any
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag, tagged := field.Tag.Lookup("db")
+			if tag == "-" {
+				continue
+			}
+			if field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i))
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			columns = append(columns, name)
+			values = append(values, v.Field(i).Interface())
+		}
+	}
+	walk(v)
+	return columns, values, nil
+}
+
+// max_identifier_length is the server's NAMEDATALEN-1; longer identifiers are silently truncated by the server.
+const max_identifier_length = 63
+
+// quoteIdent quotes name for use as an identifier in generated SQL, doubling embedded double quotes, so that any name,
+// however adversarial, stays a single identifier. Empty names, names containing NUL and names over 63 bytes are rejected.
+func quoteIdent(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", fmt.Errorf("identifier cannot be empty")
+	case len(name) > max_identifier_length:
+		return "", fmt.Errorf("identifier %.20q... is longer than %d bytes", name, max_identifier_length)
+	case strings.IndexByte(name, 0) >= 0:
+		return "", fmt.Errorf("identifier %q contains a NUL byte", name)
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`, nil
+}
+
+// quoteIdents quotes names with quoteIdent and joins them with commas.
+func quoteIdents(names []string) (string, error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		var err error
+		if quoted[i], err = quoteIdent(name); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
+// quoteTable quotes a "table" or "schema.table" name, each part with quoteIdent, so mixed-case names keep their case.
+// Names containing a literal dot are not supported.
+func quoteTable(table string) (string, error) {
+	parts := tableIdentifier(table)
+	if len(parts) > 2 {
+		return "", fmt.Errorf("table name %q has more than two parts", table)
+	}
+	for i, part := range parts {
+		var err error
+		if parts[i], err = quoteIdent(part); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// tableIdentifier splits a "table" or "schema.table" name into its parts, for the pgx APIs taking a pgx.Identifier.
+func tableIdentifier(table string) pgx.Identifier {
+	return pgx.Identifier(strings.Split(table, "."))
+}
@@ -0,0 +1,398 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type testOrder struct {
+	ID       int64  `db:"id"`
+	Customer string `db:"customerName"`
+}
+
+func TestInsertQualifiedTable(t *testing.T) {
+	tests := []struct {
+		table string
+		want  string
+	}{
+		{"orders", `INSERT INTO "orders" ("id", "customerName") VALUES ($1, $2)`},
+		{"sales.orders", `INSERT INTO "sales"."orders" ("id", "customerName") VALUES ($1, $2)`},
+		{"Sales.Orders", `INSERT INTO "Sales"."Orders" ("id", "customerName") VALUES ($1, $2)`},
+	}
+	for _, tt := range tests {
+		q := &recordingQuerier{}
+		if _, err := Insert(context.Background(), q, tt.table, testOrder{ID: 1, Customer: "ann"}); !errors.Is(err, errRecorded) {
+			t.Fatalf("Insert into %s returned %v, want the statement error", tt.table, err)
+		}
+		if sql, _ := q.last(t); sql != tt.want {
+			t.Errorf("Insert into %s sent %s, want %s", tt.table, sql, tt.want)
+		}
+	}
+}
+
+func TestQuoteTableRejectsExtraParts(t *testing.T) {
+	for _, table := range []string{"a.b.c", "db.sales.orders.x"} {
+		if quoted, err := quoteTable(table); err == nil {
+			t.Errorf("quoteTable(%q) = %s, want an error", table, quoted)
+		}
+	}
+	if _, err := Insert(context.Background(), &recordingQuerier{}, "a.b.c", testOrder{}); err == nil || errors.Is(err, errRecorded) {
+		t.Errorf("Insert into a three part name returned %v, want an error before sending", err)
+	}
+}
+
+func TestInsertSchemaQualifiedMixedCase(t *testing.T) {
+	schema := testName("Test_Schema")
+	testObject(t, `CREATE SCHEMA "`+schema+`"`, `DROP SCHEMA "`+schema+`" CASCADE`)
+	p := testPool(t)
+	ctx := testContext(t)
+	table := schema + ".Orders"
+	if _, err := p.Exec(ctx, `CREATE TABLE "`+schema+`"."Orders" (id int8 PRIMARY KEY, "customerName" text)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Insert(ctx, p, table, testOrder{ID: 1, Customer: "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Get[testOrder](ctx, p, `SELECT id, "customerName" FROM "`+schema+`"."Orders"`)
+	if err != nil || got != (testOrder{1, "ann"}) {
+		t.Errorf("inserted row = %+v, %v, want {1 ann}", got, err)
+	}
+}
+
+func TestQuoteIdentAdversarial(t *testing.T) {
+	long := strings.Repeat("x", max_identifier_length)
+	valid := []struct {
+		name string
+		want string
+	}{
+		{`a"b`, `"a""b"`},
+		{`"; DROP TABLE users; --`, `"""; DROP TABLE users; --"`},
+		{`""`, `""""""`},
+		{"MixedCase", `"MixedCase"`},
+		{long, `"` + long + `"`},
+	}
+	for _, tt := range valid {
+		if got, err := quoteIdent(tt.name); err != nil || got != tt.want {
+			t.Errorf("quoteIdent(%q) = %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+	for _, name := range []string{"", "a\x00b", long + "x", strings.Repeat("é", 32)} {
+		if got, err := quoteIdent(name); err == nil {
+			t.Errorf("quoteIdent(%q) = %s, want an error", name, got)
+		}
+	}
+}
+
+func TestQuoteColumnAndTableAdversarial(t *testing.T) {
+	long := strings.Repeat("x", max_identifier_length+1)
+	columns := []struct {
+		column string
+		want   string
+	}{
+		{`s.t.a"b`, `"s"."t"."a""b"`},
+		{`t."x"`, `"t"."""x"""`},
+	}
+	for _, tt := range columns {
+		if got, err := quoteColumn(tt.column); err != nil || got != tt.want {
+			t.Errorf("quoteColumn(%q) = %s, %v, want %s", tt.column, got, err, tt.want)
+		}
+	}
+	tables := []struct {
+		table string
+		want  string
+	}{
+		{`public.a"b`, `"public"."a""b"`},
+		{`"; DROP TABLE x`, `"""; DROP TABLE x"`},
+	}
+	for _, tt := range tables {
+		if got, err := quoteTable(tt.table); err != nil || got != tt.want {
+			t.Errorf("quoteTable(%q) = %s, %v, want %s", tt.table, got, err, tt.want)
+		}
+	}
+	for _, name := range []string{"", ".", "a.", ".a", "a\x00.b", "a.b\x00", "s." + long, long} {
+		if got, err := quoteColumn(name); err == nil {
+			t.Errorf("quoteColumn(%q) = %s, want an error", name, got)
+		}
+		if got, err := quoteTable(name); err == nil {
+			t.Errorf("quoteTable(%q) = %s, want an error", name, got)
+		}
+	}
+}
+
+func TestUpsertSQL(t *testing.T) {
+	const insert = `INSERT INTO "orders" ("id", "customerName") VALUES ($1, $2) `
+	tests := []struct {
+		name     string
+		conflict Conflict
+		want     string
+	}{
+		{"columns", OnConflictColumns("id"),
+			insert + `ON CONFLICT ("id") DO UPDATE SET "customerName" = EXCLUDED."customerName"`},
+		{"partial index", OnConflictColumns("id").Where("customerName <> ''"),
+			insert + `ON CONFLICT ("id") WHERE customerName <> '' DO UPDATE SET "customerName" = EXCLUDED."customerName"`},
+		{"every column", OnConflictColumns("id", "customerName"), insert + `ON CONFLICT ("id", "customerName") DO NOTHING`},
+		{"constraint", OnConflictConstraint("orders_Pkey"),
+			insert + `ON CONFLICT ON CONSTRAINT "orders_Pkey" DO UPDATE SET "id" = EXCLUDED."id", "customerName" = EXCLUDED."customerName"`},
+	}
+	for _, tt := range tests {
+		q := &recordingQuerier{}
+		if _, err := Upsert(context.Background(), q, "orders", tt.conflict, testOrder{ID: 1, Customer: "ann"}); !errors.Is(err, errRecorded) {
+			t.Fatalf("%s: Upsert returned %v, want the statement error", tt.name, err)
+		}
+		if sql, args := q.last(t); sql != tt.want || len(args) != 2 {
+			t.Errorf("%s: Upsert sent %s %v, want %s", tt.name, sql, args, tt.want)
+		}
+	}
+	for name, conflict := range map[string]Conflict{
+		"empty": {},
+		"both":  {columns: []string{"id"}, constraint: "orders_pkey"},
+	} {
+		if _, err := Upsert(context.Background(), &recordingQuerier{}, "orders", conflict, testOrder{}); err == nil || errors.Is(err, errRecorded) {
+			t.Errorf("%s conflict target: Upsert returned %v, want an error before sending", name, err)
+		}
+	}
+}
+
+func TestInsertReturning(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testTable(t, "insert_returning", `id int8 PRIMARY KEY, "customerName" text`)
+	insert := `INSERT INTO ` + table + ` (id, "customerName") VALUES ($1, $2) ON CONFLICT (id) DO NOTHING RETURNING id, "customerName"`
+	order, err := InsertReturning[testOrder](ctx, p, insert, 1, "ann")
+	if err != nil || order != (testOrder{ID: 1, Customer: "ann"}) {
+		t.Errorf("InsertReturning = %+v, %v, want the inserted row", order, err)
+	}
+	id, err := InsertReturning[int64](ctx, p, `INSERT INTO `+table+` (id, "customerName") VALUES (2, 'bob') RETURNING id`)
+	if err != nil || id != 2 {
+		t.Errorf("InsertReturning a single column = %d, %v, want 2", id, err)
+	}
+	if _, err := InsertReturning[testOrder](ctx, p, insert, 1, "eve"); !errors.Is(err, ErrNoRows) {
+		t.Errorf("InsertReturning on a conflict = %v, want ErrNoRows", err)
+	}
+	if name, err := Scalar[string](ctx, p, `SELECT "customerName" FROM `+table+` WHERE id = 1`); err != nil || name != "ann" {
+		t.Errorf("row 1 has customer %q, %v, want ann unchanged", name, err)
+	}
+}
+
+func TestSelectByCompositeKeysSQL(t *testing.T) {
+	ctx := context.Background()
+	q := &recordingQuerier{}
+	if _, err := SelectByCompositeKeys[testOrder](ctx, q, "sales.orders", []string{"region", "id"}, [][]any{{"eu", 1}, {"us", 2}}); !errors.Is(err, errRecorded) {
+		t.Fatalf("SelectByCompositeKeys returned %v, want the statement error", err)
+	}
+	want := `SELECT * FROM "sales"."orders" WHERE ("region", "id") IN (($1, $2), ($3, $4))`
+	if sql, args := q.last(t); sql != want || !reflect.DeepEqual(args, []any{"eu", 1, "us", 2}) {
+		t.Errorf("SelectByCompositeKeys sent %s %v, want %s [eu 1 us 2]", sql, args, want)
+	}
+	q = &recordingQuerier{}
+	rows, err := SelectByCompositeKeys[testOrder](ctx, q, "orders", []string{"region", "id"}, nil)
+	if err != nil || rows == nil || len(rows) != 0 || len(q.sql) != 0 {
+		t.Errorf("SelectByCompositeKeys without keys = %v, %v after sending %q, want an empty slice and no statement", rows, err, q.sql)
+	}
+	if _, err := SelectByCompositeKeys[testOrder](ctx, q, "orders", []string{"region", "id"}, [][]any{{"eu", 1}, {"us"}}); err == nil || len(q.sql) != 0 {
+		t.Errorf("SelectByCompositeKeys with a short key = %v, want an error before sending", err)
+	}
+	if _, err := SelectByCompositeKeys[testOrder](ctx, q, "orders", nil, [][]any{{1}}); err == nil || len(q.sql) != 0 {
+		t.Errorf("SelectByCompositeKeys without key columns = %v, want an error before sending", err)
+	}
+}
+
+func TestSelectByCompositeKeys(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testTable(t, "composite_keys", `region text, id int8, "customerName" text, PRIMARY KEY (region, id)`)
+	if _, err := p.Exec(ctx, `INSERT INTO `+table+` VALUES ('eu', 1, 'ann'), ('us', 1, 'bob'), ('eu', 2, 'eve')`); err != nil {
+		t.Fatal(err)
+	}
+	type order struct {
+		Region   string `db:"region"`
+		ID       int64  `db:"id"`
+		Customer string `db:"customerName"`
+	}
+	rows, err := SelectByCompositeKeys[order](ctx, p, table, []string{"region", "id"}, [][]any{{"us", 1}, {"eu", 2}, {"us", 9}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Customer < rows[j].Customer })
+	if want := []order{{"us", 1, "bob"}, {"eu", 2, "eve"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("SelectByCompositeKeys = %v, want %v", rows, want)
+	}
+}
+
+// copyingQuerier is a recordingQuerier whose CopyFrom reads the rows of the source like pgx does, keeping them.
+type copyingQuerier struct {
+	recordingQuerier
+	rows [][]any
+}
+
+func (q *copyingQuerier) CopyFrom(_ context.Context, _ pgx.Identifier, _ []string, src pgx.CopyFromSource) (int64, error) {
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		q.rows = append(q.rows, values)
+	}
+	return int64(len(q.rows)), src.Err()
+}
+
+// countingRows returns a CopyInsertFunc generator of n rows of an id and its square, failing with err after the rows if err is set.
+func countingRows(n int, err error) func() ([]any, bool, error) {
+	i := 0
+	return func() ([]any, bool, error) {
+		if i == n {
+			return nil, false, err
+		}
+		i++
+		return []any{i, i * i}, true, nil
+	}
+}
+
+func TestCopyInsertFuncRows(t *testing.T) {
+	q := &copyingQuerier{}
+	n, err := CopyInsertFunc(context.Background(), q, "squares", []string{"n", "square"}, countingRows(3, nil))
+	if err != nil || n != 3 {
+		t.Fatalf("CopyInsertFunc = %d, %v, want 3 rows", n, err)
+	}
+	if want := [][]any{{1, 1}, {2, 4}, {3, 9}}; !reflect.DeepEqual(q.rows, want) {
+		t.Errorf("copied %v, want %v", q.rows, want)
+	}
+	errGenerator := errors.New("generator failed")
+	if _, err := CopyInsertFunc(context.Background(), &copyingQuerier{}, "squares", []string{"n", "square"}, countingRows(2, errGenerator)); !errors.Is(err, errGenerator) {
+		t.Errorf("CopyInsertFunc with a failing generator = %v, want its error", err)
+	}
+	if _, err := CopyInsertFunc(context.Background(), &copyingQuerier{}, "a.b.c", []string{"n"}, countingRows(1, nil)); err == nil {
+		t.Error("CopyInsertFunc into a three part name succeeded")
+	}
+}
+
+func TestCopyInsertFunc(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testTable(t, "copy_func", "n int8, square int8")
+	n, err := CopyInsertFunc(ctx, p, table, []string{"n", "square"}, countingRows(1000, nil))
+	if err != nil || n != 1000 {
+		t.Fatalf("CopyInsertFunc = %d, %v, want 1000 rows", n, err)
+	}
+	errGenerator := errors.New("generator failed")
+	if _, err := CopyInsertFunc(ctx, p, table, []string{"n", "square"}, countingRows(500, errGenerator)); !errors.Is(err, errGenerator) {
+		t.Errorf("CopyInsertFunc with a failing generator = %v, want its error", err)
+	}
+	if sum, err := Scalar[int64](ctx, p, "SELECT sum(square) FROM "+table); err != nil || sum != 333833500 {
+		t.Errorf("sum of squares = %d, %v, want 333833500 from the first COPY only", sum, err)
+	}
+}
+
+func TestGetOrCreatePaths(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	columns := []fakeColumn{{name: "id", oid: pgtype.Int8OID}, {name: "customerName", oid: pgtype.TextOID}}
+	server.answer("INSERT ann RETURNING *", columns, []any{int64(1), "ann"})
+	server.answer("INSERT bob RETURNING *", columns)
+	server.answer("SELECT bob", columns, []any{int64(2), "bob"})
+	order, created, err := GetOrCreate[testOrder](ctx, p, "INSERT ann RETURNING *", "SELECT ann")
+	if err != nil || !created || order != (testOrder{1, "ann"}) {
+		t.Errorf("GetOrCreate inserting = %+v, %t, %v, want the inserted row", order, created, err)
+	}
+	if got, want := drainQueries(server), []string{"begin", "INSERT ann RETURNING *", "commit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q inserting, want %q", got, want)
+	}
+	order, created, err = GetOrCreate[testOrder](ctx, p, "INSERT bob RETURNING *", "SELECT bob")
+	if err != nil || created || order != (testOrder{2, "bob"}) {
+		t.Errorf("GetOrCreate on a conflict = %+v, %t, %v, want the existing row", order, created, err)
+	}
+	if got, want := drainQueries(server), []string{"begin", "INSERT bob RETURNING *", "SELECT bob", "commit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q on a conflict, want %q", got, want)
+	}
+}
+
+func TestGetOrCreateConcurrent(t *testing.T) {
+	p := testPool(t, WithMaxConns(8))
+	ctx := testContext(t)
+	table := testTable(t, "get_or_create", `id int8 GENERATED ALWAYS AS IDENTITY, "customerName" text UNIQUE`)
+	insert := `INSERT INTO ` + table + ` ("customerName") VALUES ($1) ON CONFLICT ("customerName") DO NOTHING RETURNING id, "customerName"`
+	query := `SELECT id, "customerName" FROM ` + table + ` WHERE "customerName" = $1`
+	const callers = 8
+	orders := make([]testOrder, callers)
+	created := make([]bool, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			orders[i], created[i], errs[i] = GetOrCreate[testOrder](ctx, p, insert, query, "ann")
+		}(i)
+	}
+	wg.Wait()
+	creators := 0
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if created[i] {
+			creators++
+		}
+		if orders[i] != orders[0] {
+			t.Errorf("caller %d got %+v, caller 0 %+v, want the same row", i, orders[i], orders[0])
+		}
+	}
+	if creators != 1 {
+		t.Errorf("%d callers created the row, want 1", creators)
+	}
+	if n, err := Count(ctx, p, table, ""); err != nil || n != 1 {
+		t.Errorf("%s has %d rows, %v, want 1", table, n, err)
+	}
+}
+
+func TestUpdateIfVersionSQL(t *testing.T) {
+	ctx := context.Background()
+	q := &recordingQuerier{}
+	_ = UpdateIfVersion(ctx, q, "sales.orders", 9, 3, map[string]any{"status": "paid", "customerName": "ann"})
+	want := `UPDATE "sales"."orders" SET "customerName" = $1, "status" = $2, "version" = "version" + 1 WHERE "id" = $3 AND "version" = $4`
+	if sql, args := q.last(t); sql != want || !reflect.DeepEqual(args, []any{"ann", "paid", 9, 3}) {
+		t.Errorf("UpdateIfVersion sent %s %v, want %s [ann paid 9 3]", sql, args, want)
+	}
+	for _, set := range []map[string]any{nil, {"id": 1}, {"version": 2, "status": "paid"}} {
+		q := &recordingQuerier{}
+		if err := UpdateIfVersion(ctx, q, "orders", 9, 3, set); err == nil || len(q.sql) != 0 {
+			t.Errorf("UpdateIfVersion setting %v = %v, want an error before sending", set, err)
+		}
+	}
+}
+
+func TestUpdateIfVersion(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testTable(t, "update_if_version", `id int8 PRIMARY KEY, version int NOT NULL, "customerName" text`)
+	if _, err := p.Exec(ctx, `INSERT INTO `+table+` VALUES (1, 1, 'ann')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateIfVersion(ctx, p, table, 1, 1, map[string]any{"customerName": "bob"}); err != nil {
+		t.Fatalf("UpdateIfVersion at the current version = %v", err)
+	}
+	// A writer that read version 1 before the update above is now stale.
+	if err := UpdateIfVersion(ctx, p, table, 1, 1, map[string]any{"customerName": "eve"}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateIfVersion at a stale version = %v, want ErrVersionConflict", err)
+	}
+	if err := UpdateIfVersion(ctx, p, table, 2, 1, map[string]any{"customerName": "eve"}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateIfVersion of a missing row = %v, want ErrVersionConflict", err)
+	}
+	var version int
+	var customer string
+	if err := p.QueryRow(ctx, `SELECT version, "customerName" FROM `+table+` WHERE id = 1`).Scan(&version, &customer); err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 || customer != "bob" {
+		t.Errorf("row is at version %d with customer %q, want 2 and bob", version, customer)
+	}
+}
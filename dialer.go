@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// applyDialer replaces the pgconn dialer when an option customizes dialing.
+func applyDialer(cfg *pgxpool.Config, opt *options) {
+	if len(opt.dialer) == 0 && len(opt.dialhooks) == 0 {
+		return
+	}
+	settings, hooks := opt.dialer, opt.dialhooks
+	cfg.ConnConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer := &net.Dialer{}
+		for _, setting := range settings {
+			setting(dialer, network)
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, hook := range hooks {
+			if err := hook(conn); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+}
+
+// SocketBuffers sets the SO_RCVBUF (read) and SO_SNDBUF (write) sizes in bytes of TCP connections, which helps bulk COPY and large results.
+// The operating system may clamp or round the values, e.g. to net.core.rmem_max/wmem_max on Linux. Unix socket connections are not affected.
+func WithSocketBuffers(read, write int) Option {
+	return func(options *options) error {
+		if read <= 0 || write <= 0 {
+			return fmt.Errorf("socket buffer sizes must be greater than zero")
+		}
+		options.dialhooks = append(options.dialhooks, func(conn net.Conn) error {
+			tcp, ok := conn.(*net.TCPConn)
+			if !ok {
+				return nil
+			}
+			if err := tcp.SetReadBuffer(read); err != nil {
+				return fmt.Errorf("set socket read buffer: %w", err)
+			}
+			if err := tcp.SetWriteBuffer(write); err != nil {
+				return fmt.Errorf("set socket write buffer: %w", err)
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+// LocalAddr binds outgoing TCP connections to the local address addr, an IP address with an optional port ("10.0.0.5" or "10.0.0.5:0"),
+// for multi-homed hosts where firewall or routing rules require a specific interface. Unix socket connections are not affected.
+func WithLocalAddr(addr string) Option {
+	return func(options *options) error {
+		host, port := addr, "0"
+		if h, p, err := net.SplitHostPort(addr); err == nil {
+			host, port = h, p
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("invalid local address %q", addr)
+		}
+		local, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(ip.String(), port))
+		if err != nil {
+			return fmt.Errorf("invalid local address %q: %w", addr, err)
+		}
+		options.dialer = append(options.dialer, func(dialer *net.Dialer, network string) {
+			if strings.HasPrefix(network, "tcp") {
+				dialer.LocalAddr = local
+			}
+		})
+		return nil
+	}
+}
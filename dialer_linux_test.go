@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestSocketBuffersSizes(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	const read, write = 12 << 10, 20 << 10
+	var got [2]int
+	readBack := func(options *options) error {
+		options.dialhooks = append(options.dialhooks, func(conn net.Conn) error {
+			raw, err := conn.(*net.TCPConn).SyscallConn()
+			if err != nil {
+				return err
+			}
+			var sockErr error
+			if err := raw.Control(func(fd uintptr) {
+				if got[0], sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF); sockErr == nil {
+					got[1], sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+				}
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		})
+		return nil
+	}
+	_, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithSocketBuffers(read, write), readBack)
+	if !IsTooManyConnections(err) {
+		t.Fatalf("New error = %v, want the server's rejection after a successful dial", err)
+	}
+	// Linux doubles the requested sizes to leave room for bookkeeping. The sizes are below its defaults, so they only show up
+	// if the option set them.
+	if got[0] != 2*read || got[1] != 2*write {
+		t.Errorf("SO_RCVBUF, SO_SNDBUF = %d, %d, want %d, %d", got[0], got[1], 2*read, 2*write)
+	}
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDialer is an Option adding a dial hook that keeps every connection the pool dials, after the hooks of the options
+// passed before it have run on the connection.
+type recordingDialer struct {
+	mu    sync.Mutex
+	conns []net.Conn
+	err   error // returned by the hook, failing the dial
+}
+
+func (d *recordingDialer) option() Option {
+	return func(options *options) error {
+		options.dialhooks = append(options.dialhooks, func(conn net.Conn) error {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.conns = append(d.conns, conn)
+			return d.err
+		})
+		return nil
+	}
+}
+
+func (d *recordingDialer) dialed() []net.Conn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]net.Conn(nil), d.conns...)
+}
+
+func TestSocketBuffersValidate(t *testing.T) {
+	for _, sizes := range [][2]int{{0, 1024}, {1024, 0}, {-1, 1024}} {
+		if err := WithSocketBuffers(sizes[0], sizes[1])(&options{}); err == nil {
+			t.Errorf("WithSocketBuffers(%d, %d) was accepted", sizes[0], sizes[1])
+		}
+	}
+}
+
+func TestSocketBuffersDial(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	var dialer recordingDialer
+	_, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithSocketBuffers(256<<10, 512<<10), dialer.option())
+	if !IsTooManyConnections(err) {
+		t.Fatalf("New error = %v, want the server's rejection after a successful dial", err)
+	}
+	conns := dialer.dialed()
+	if len(conns) == 0 {
+		t.Fatal("the pool did not dial through the custom dialer")
+	}
+	if _, ok := conns[0].(*net.TCPConn); !ok {
+		t.Errorf("dialed a %T, want a *net.TCPConn whose buffers were set", conns[0])
+	}
+	if got := conns[0].RemoteAddr().(*net.TCPAddr).Port; got != server.port {
+		t.Errorf("dialed port %d, want %d", got, server.port)
+	}
+}
+
+func TestDialHookFailureClosesConn(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	dialer := recordingDialer{err: errors.New("hook failed")}
+	_, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), dialer.option())
+	if !errors.Is(err, dialer.err) {
+		t.Fatalf("New error = %v, want the dial hook's error", err)
+	}
+	for _, conn := range dialer.dialed() {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte{0}); !errors.Is(err, net.ErrClosed) {
+			t.Errorf("write to a connection failing its dial hook = %v, want it closed", err)
+		}
+	}
+}
+
+func TestLocalAddrValidate(t *testing.T) {
+	for _, addr := range []string{"", "localhost", "10.0.0.5:port", "10.0.0.5:70000", "not an ip", "10.0.0.300"} {
+		if err := WithLocalAddr(addr)(&options{}); err == nil {
+			t.Errorf("WithLocalAddr(%q) was accepted", addr)
+		}
+	}
+	for _, addr := range []string{"10.0.0.5", "10.0.0.5:0", "::1", "[::1]:5000"} {
+		if err := WithLocalAddr(addr)(&options{}); err != nil {
+			t.Errorf("WithLocalAddr(%q) = %v", addr, err)
+		}
+	}
+}
+
+func TestLocalAddrDial(t *testing.T) {
+	// 127.0.0.2 is a loopback address distinct from the default source address 127.0.0.1 on Linux; elsewhere it may not exist.
+	probe, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	probe.Close()
+	server := newRejectingServer(t, "53300")
+	var dialer recordingDialer
+	_, err = New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithLocalAddr("127.0.0.2"), dialer.option())
+	if !IsTooManyConnections(err) {
+		t.Fatalf("New error = %v, want the server's rejection after a successful dial", err)
+	}
+	conns := dialer.dialed()
+	if len(conns) == 0 {
+		t.Fatal("the pool did not dial through the custom dialer")
+	}
+	for _, conn := range conns {
+		if local := conn.LocalAddr().(*net.TCPAddr); !local.IP.Equal(net.ParseIP("127.0.0.2")) {
+			t.Errorf("connection dialed from %s, want 127.0.0.2", local)
+		}
+	}
+}
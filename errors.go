@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// sqlState returns the SQLSTATE code of err, or an empty string if err is not a server error.
+func sqlState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// IsTooManyConnections reports whether err is a too_many_connections (SQLSTATE 53300) server error.
+func IsTooManyConnections(err error) bool {
+	return sqlState(err) == "53300"
+}
+
+// IsAuthenticationError reports whether err is an invalid_password (SQLSTATE 28P01) or invalid_authorization_specification (28000)
+// server error, i.e. a wrong password or a connection rejected by pg_hba.conf.
+func IsAuthenticationError(err error) bool {
+	switch sqlState(err) {
+	case "28P01", "28000":
+		return true
+	}
+	return false
+}
+
+// wrapAuthenticationError annotates authentication errors with the user that was rejected. The password is never included.
+func wrapAuthenticationError(err error, user string) error {
+	if IsAuthenticationError(err) {
+		return fmt.Errorf("authentication failed for user %q, check the password and the pg_hba.conf entry for this host: %w", user, err)
+	}
+	return err
+}
+
+// IsResourceError reports whether err is an insufficient_resources (SQLSTATE class 53) server error, such as disk_full (53100),
+// out_of_memory (53200) or too_many_connections (53300). These point at the server's infrastructure rather than at the application.
+func IsResourceError(err error) bool {
+	return strings.HasPrefix(sqlState(err), "53")
+}
+
+// wrapConnectError annotates connection errors with a hint on how to fix them.
+func wrapConnectError(err error) error {
+	switch {
+	case IsTooManyConnections(err):
+		return fmt.Errorf("server has no connection slots left, lower WithMaxConns across the pools or raise max_connections: %w", err)
+	case IsResourceError(err):
+		return wrapResourceError(err)
+	}
+	return err
+}
+
+// wrapResourceError marks server resource errors as infrastructure problems, so they stand out in logs and alerts.
+func wrapResourceError(err error) error {
+	if IsResourceError(err) {
+		return fmt.Errorf("server out of resources (SQLSTATE %s), check its disk and memory: %w", sqlState(err), err)
+	}
+	return err
+}
+
+// Acquire is pgxpool.Pool.Acquire with connection errors annotated with a hint, see IsTooManyConnections.
+func (p *Pool) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	conn, err := p.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, wrapConnectError(err)
+	}
+	return conn, nil
+}
+
+// IsReadOnlyTransaction reports whether err is a read_only_sql_transaction (SQLSTATE 25006) error, typically a write sent to a read-only replica.
+func IsReadOnlyTransaction(err error) bool {
+	return sqlState(err) == "25006"
+}
+
+// IsServerShutdown reports whether err means the server is shutting down or restarting: admin_shutdown (SQLSTATE 57P01)
+// or cannot_connect_now (57P03).
+func IsServerShutdown(err error) bool {
+	switch sqlState(err) {
+	case "57P01", "57P03":
+		return true
+	}
+	return false
+}
+
+const (
+	shutdown_reset_interval = time.Second
+	shutdown_reset_errors   = 3 // admin_shutdown errors within shutdown_reset_interval taken as a shutdown without a check
+	shutdown_check_timeout  = 5 * time.Second
+)
+
+// ShutdownReset resets the pool when the server shuts down or restarts, so the other connections to the old server process
+// are discarded at once instead of failing one by one. A single admin_shutdown (57P01) is also what pg_terminate_backend, and
+// so TerminateBackend, produces for one connection, so it only triggers a reset once a fresh connection to the server fails
+// or several such errors arrive within a second. cannot_connect_now (57P03) while connecting resets the pool immediately.
+// Resets are limited to one per second.
+func WithShutdownReset() Option {
+	return func(options *options) error {
+		watcher := &shutdownWatcher{}
+		options.tracers = append(options.tracers, func(string) pgx.QueryTracer {
+			return watcher
+		})
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			watcher.pool.Store(p)
+			return nil
+		})
+		return nil
+	}
+}
+
+type shutdownWatcher struct {
+	pool atomic.Pointer[Pool]
+
+	mu        sync.Mutex
+	lastReset time.Time
+	since     time.Time // start of the window errors are counted in
+	errors    int
+	checking  bool
+}
+
+func (w *shutdownWatcher) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (w *shutdownWatcher) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if sqlState(data.Err) == "57P01" {
+		w.observe(ctx, data.Err, false)
+	}
+}
+
+func (w *shutdownWatcher) TraceConnectStart(ctx context.Context, _ pgx.TraceConnectStartData) context.Context {
+	return ctx
+}
+
+func (w *shutdownWatcher) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	if sqlState(data.Err) == "57P03" {
+		w.observe(ctx, data.Err, true)
+	}
+}
+
+// observe records a shutdown error and resets the pool if confirmed is set, enough errors arrived or a check finds the server down.
+func (w *shutdownWatcher) observe(ctx context.Context, err error, confirmed bool) {
+	p := w.pool.Load()
+	if p == nil {
+		return
+	}
+	w.mu.Lock()
+	now := time.Now()
+	if now.Sub(w.lastReset) < shutdown_reset_interval {
+		w.mu.Unlock()
+		return
+	}
+	if now.Sub(w.since) > shutdown_reset_interval {
+		w.since, w.errors = now, 0
+	}
+	w.errors++
+	if confirmed || w.errors >= shutdown_reset_errors {
+		w.lastReset, w.errors = now, 0
+		w.mu.Unlock()
+		w.reset(ctx, p, err)
+		return
+	}
+	if w.checking {
+		w.mu.Unlock()
+		return
+	}
+	w.checking = true
+	w.mu.Unlock()
+	started := p.goBackground(func(ctx context.Context) {
+		down := serverDown(ctx, p)
+		w.mu.Lock()
+		w.checking = false
+		down = down && time.Since(w.lastReset) >= shutdown_reset_interval
+		if down {
+			w.lastReset, w.errors = time.Now(), 0
+		}
+		w.mu.Unlock()
+		if down {
+			w.reset(ctx, p, err)
+		}
+	})
+	if !started {
+		w.mu.Lock()
+		w.checking = false
+		w.mu.Unlock()
+	}
+}
+
+func (w *shutdownWatcher) reset(ctx context.Context, p *Pool, err error) {
+	p.log(ctx, tracelog.LogLevelWarn, "server shutdown detected, resetting pool", map[string]any{"err": err})
+	p.Pool.Reset()
+}
+
+// serverDown reports whether a fresh connection, made outside the pool with its configuration and BeforeConnect hook, fails.
+func serverDown(ctx context.Context, p *Pool) bool {
+	ctx, cancel := context.WithTimeout(ctx, shutdown_check_timeout)
+	defer cancel()
+	cfg := p.Config()
+	cfg.ConnConfig.Tracer = nil // the check is not a pool connection, keep it out of logs, events and metrics
+	if cfg.BeforeConnect != nil {
+		if err := cfg.BeforeConnect(ctx, cfg.ConnConfig); err != nil {
+			return false
+		}
+	}
+	conn, err := pgx.ConnectConfig(ctx, cfg.ConnConfig)
+	if err != nil {
+		// a timed out check proves nothing, the server may be slow rather than down
+		return ctx.Err() == nil
+	}
+	conn.Close(ctx)
+	return false
+}
@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func pgError(code string) error {
+	return fmt.Errorf("query: %w", &pgconn.PgError{Code: code, Message: "test error " + code})
+}
+
+func TestIsServerShutdown(t *testing.T) {
+	for code, want := range map[string]bool{"57P01": true, "57P03": true, "57014": false, "08006": false} {
+		if got := IsServerShutdown(pgError(code)); got != want {
+			t.Errorf("IsServerShutdown(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsServerShutdown(errors.New("plain error")) || IsServerShutdown(nil) {
+		t.Error("IsServerShutdown accepted an error without SQLSTATE")
+	}
+}
+
+const shutdown_log = "server shutdown detected, resetting pool"
+
+func TestShutdownWatcherResetsOnCannotConnectNow(t *testing.T) {
+	var logs logRecorder
+	w := &shutdownWatcher{}
+	w.pool.Store(unreachablePool(t, &logs))
+	w.TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{Err: pgError("57P03")})
+	w.TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{Err: pgError("57P03")})
+	if n := logs.count(shutdown_log); n != 1 {
+		t.Errorf("pool was reset %d times, want 1 since resets are rate limited", n)
+	}
+}
+
+func TestShutdownWatcherChecksSingleAdminShutdown(t *testing.T) {
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	w := &shutdownWatcher{}
+	w.pool.Store(p)
+	w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57P01")})
+	p.wg.Wait()
+	if n := logs.count(shutdown_log); n != 1 {
+		t.Errorf("pool was reset %d times after the check failed to connect, want 1", n)
+	}
+}
+
+func TestShutdownWatcherCountsAdminShutdowns(t *testing.T) {
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	p.closed = true // no background checks, only the error count can trigger a reset
+	w := &shutdownWatcher{}
+	w.pool.Store(p)
+	for i := 1; i < shutdown_reset_errors; i++ {
+		w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57P01")})
+	}
+	if n := logs.count(shutdown_log); n != 0 {
+		t.Fatalf("pool was reset after %d admin_shutdown errors", shutdown_reset_errors-1)
+	}
+	w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57P01")})
+	if n := logs.count(shutdown_log); n != 1 {
+		t.Errorf("pool was reset %d times after %d admin_shutdown errors, want 1", n, shutdown_reset_errors)
+	}
+}
+
+func TestShutdownWatcherForgetsOldErrors(t *testing.T) {
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	p.closed = true
+	w := &shutdownWatcher{}
+	w.pool.Store(p)
+	for i := 1; i < shutdown_reset_errors; i++ {
+		w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57P01")})
+	}
+	w.mu.Lock()
+	w.since = time.Now().Add(-2 * shutdown_reset_interval)
+	w.mu.Unlock()
+	w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57P01")})
+	if n := logs.count(shutdown_log); n != 0 {
+		t.Error("errors from an earlier window were counted towards a reset")
+	}
+}
+
+func TestShutdownWatcherIgnoresOtherErrors(t *testing.T) {
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	w := &shutdownWatcher{}
+	w.pool.Store(p)
+	for i := 0; i < shutdown_reset_errors; i++ {
+		w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57014")})
+		w.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: pgError("57P03")})
+		w.TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{Err: pgError("57P01")})
+	}
+	p.wg.Wait()
+	if n := logs.count(shutdown_log); n != 0 {
+		t.Errorf("pool was reset %d times for errors that are not a shutdown", n)
+	}
+	// without a pool, as before New returns, errors are ignored
+	(&shutdownWatcher{}).TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{Err: pgError("57P03")})
+}
+
+func TestShutdownResetDiscardsIdleConns(t *testing.T) {
+	server := newAcceptingServer(t)
+	server.fail("SELECT pg_sleep(1)", "57P01")
+	p := fakePool(t, server, WithShutdownReset(), WithMaxConns(3))
+	ctx := testContext(t)
+	conns := make([]*pgxpool.Conn, 3)
+	for i := range conns {
+		conn, err := p.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = conn
+	}
+	for _, conn := range conns {
+		conn.Release()
+	}
+	if n := p.Stat().IdleConns(); n != 3 {
+		t.Fatalf("pool holds %d idle connections, want 3", n)
+	}
+	for i := 0; i < shutdown_reset_errors; i++ {
+		if _, err := p.Exec(ctx, "SELECT pg_sleep(1)", pgx.QueryExecModeSimpleProtocol); sqlState(err) != "57P01" {
+			t.Fatalf("Exec error = %v, want admin_shutdown", err)
+		}
+	}
+	if n := p.Stat().IdleConns(); n != 0 {
+		t.Errorf("pool holds %d idle connections after the shutdown, want 0", n)
+	}
+	p.wg.Wait() // the check started by the first error logs in too
+	logins := len(server.startups)
+	if err := p.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.startups); n <= logins {
+		t.Error("pool reused a connection from before the shutdown instead of connecting again")
+	}
+}
+
+func TestIsTooManyConnections(t *testing.T) {
+	for code, want := range map[string]bool{"53300": true, "53200": false, "57P03": false} {
+		if got := IsTooManyConnections(pgError(code)); got != want {
+			t.Errorf("IsTooManyConnections(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsTooManyConnections(errors.New("plain error")) || IsTooManyConnections(nil) {
+		t.Error("IsTooManyConnections accepted an error without SQLSTATE")
+	}
+	err := wrapConnectError(pgError("53300"))
+	if !IsTooManyConnections(err) || !strings.Contains(err.Error(), "WithMaxConns") {
+		t.Errorf("wrapConnectError(53300) = %v, want a WithMaxConns hint wrapping the server error", err)
+	}
+}
+
+func TestTooManyConnectionsOnConnect(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	ctx := context.Background()
+	opts := []Option{WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable")}
+	_, err := New(ctx, opts...)
+	if !IsTooManyConnections(err) || !strings.Contains(err.Error(), "no connection slots left") {
+		t.Errorf("New error = %v, want a too_many_connections error with a hint", err)
+	}
+	p, err := New(ctx, append(opts, WithAsyncStartupPing(1, time.Millisecond))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	_, err = p.Acquire(ctx)
+	if !IsTooManyConnections(err) || !strings.Contains(err.Error(), "no connection slots left") {
+		t.Errorf("Acquire error = %v, want a too_many_connections error with a hint", err)
+	}
+}
+
+func TestIsReadOnlyTransaction(t *testing.T) {
+	for code, want := range map[string]bool{"25006": true, "25001": false, "42501": false} {
+		if got := IsReadOnlyTransaction(pgError(code)); got != want {
+			t.Errorf("IsReadOnlyTransaction(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsReadOnlyTransaction(errors.New("plain error")) || IsReadOnlyTransaction(nil) {
+		t.Error("IsReadOnlyTransaction accepted an error without SQLSTATE")
+	}
+}
+
+func TestIsReadOnlyTransactionOnWrite(t *testing.T) {
+	table := testTable(t, "test_read_only", "id int")
+	p := testPool(t)
+	ctx := testContext(t)
+	err := p.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.Exec(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO "+table+" VALUES (1)")
+		return err
+	})
+	if !IsReadOnlyTransaction(err) {
+		t.Errorf("write in a read-only transaction = %v, want read_only_sql_transaction", err)
+	}
+}
+
+func TestIsAuthenticationError(t *testing.T) {
+	for code, want := range map[string]bool{"28P01": true, "28000": true, "53300": false, "42501": false} {
+		if got := IsAuthenticationError(pgError(code)); got != want {
+			t.Errorf("IsAuthenticationError(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsAuthenticationError(errors.New("plain error")) || IsAuthenticationError(nil) {
+		t.Error("IsAuthenticationError accepted an error without SQLSTATE")
+	}
+	if err := wrapAuthenticationError(pgError("53300"), "app"); strings.Contains(err.Error(), "authentication") {
+		t.Errorf("wrapAuthenticationError annotated a non-authentication error: %v", err)
+	}
+}
+
+func TestAuthenticationErrorOnNew(t *testing.T) {
+	const pass = "s3cret-password"
+	for _, code := range []string{"28P01", "28000"} {
+		server := newRejectingServer(t, code)
+		_, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+			WithUser("app_user"), WithPass(pass))
+		if !IsAuthenticationError(err) {
+			t.Fatalf("New error = %v, want an authentication error", err)
+		}
+		if msg := err.Error(); !strings.Contains(msg, `user "app_user"`) || strings.Contains(msg, pass) {
+			t.Errorf("New error = %q, want it to name the user and leave out the password", msg)
+		}
+	}
+}
+
+func TestIsResourceError(t *testing.T) {
+	for code, want := range map[string]bool{"53100": true, "53200": true, "53300": true, "54000": false, "42P01": false} {
+		if got := IsResourceError(pgError(code)); got != want {
+			t.Errorf("IsResourceError(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsResourceError(errors.New("plain error")) || IsResourceError(nil) {
+		t.Error("IsResourceError accepted an error without SQLSTATE")
+	}
+}
+
+func TestWrapResourceError(t *testing.T) {
+	for _, code := range []string{"53100", "53200"} {
+		err := wrapResourceError(pgError(code))
+		if !IsResourceError(err) || !strings.Contains(err.Error(), "server out of resources (SQLSTATE "+code+")") {
+			t.Errorf("wrapResourceError(%s) = %v, want it marked as a resource error", code, err)
+		}
+		if err := wrapConnectError(pgError(code)); !strings.Contains(err.Error(), "server out of resources") {
+			t.Errorf("wrapConnectError(%s) = %v, want it marked as a resource error", code, err)
+		}
+	}
+	plain := pgError("42P01")
+	if err := wrapResourceError(plain); err != plain {
+		t.Errorf("wrapResourceError changed a non-resource error: %v", err)
+	}
+}
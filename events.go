@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventType is the kind of a PoolEvent.
+type EventType string
+
+const (
+	EventConnect    EventType = "connect"    // a new connection was established
+	EventDisconnect EventType = "disconnect" // a connection is being closed by the pool
+	EventAcquire    EventType = "acquire"    // a connection was acquired
+	EventRelease    EventType = "release"    // a connection is being released
+	EventError      EventType = "error"      // connecting or acquiring failed, see Err
+)
+
+// PoolEvent is a lifecycle event of a pool connection sent by WithEventChannel.
+type PoolEvent struct {
+	Type EventType
+	Pool string // see WithName
+	Time time.Time
+	PID  int32 // backend process ID, 0 for errors
+	Err  error
+}
+
+// EventChannel sends the connection lifecycle events of the pool to ch. Events are sent without blocking: when ch is full the event
+// is dropped and counted in DroppedEvents, so a slow consumer never slows the pool down. Give ch a buffer sized for bursts.
+// ch is not closed by the pool.
+func WithEventChannel(ch chan<- PoolEvent) Option {
+	return func(options *options) error {
+		if ch == nil {
+			return fmt.Errorf("event channel cannot be nil")
+		}
+		events := &eventSender{ch: ch}
+		options.tracers = append(options.tracers, func(name string) pgx.QueryTracer {
+			events.name = name
+			return events
+		})
+		options.beforeclose = append(options.beforeclose, func(conn *pgx.Conn) {
+			events.send(EventDisconnect, conn, nil)
+		})
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			p.events = events
+			return nil
+		})
+		return nil
+	}
+}
+
+// DroppedEvents returns the number of events WithEventChannel dropped because the channel was full.
+func (p *Pool) DroppedEvents() uint64 {
+	if p.events == nil {
+		return 0
+	}
+	return p.events.dropped.Load()
+}
+
+type eventSender struct {
+	ch      chan<- PoolEvent
+	name    string
+	dropped atomic.Uint64
+}
+
+func (s *eventSender) send(typ EventType, conn *pgx.Conn, err error) {
+	event := PoolEvent{Type: typ, Pool: s.name, Time: time.Now(), Err: err}
+	if conn != nil && err == nil {
+		event.PID = int32(conn.PgConn().PID())
+	}
+	select {
+	case s.ch <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *eventSender) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (s *eventSender) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+func (s *eventSender) TraceConnectStart(ctx context.Context, _ pgx.TraceConnectStartData) context.Context {
+	return ctx
+}
+
+func (s *eventSender) TraceConnectEnd(_ context.Context, data pgx.TraceConnectEndData) {
+	if data.Err != nil {
+		s.send(EventError, nil, data.Err)
+		return
+	}
+	s.send(EventConnect, data.Conn, nil)
+}
+
+func (s *eventSender) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return ctx
+}
+
+func (s *eventSender) TraceAcquireEnd(_ context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if data.Err != nil {
+		s.send(EventError, nil, data.Err)
+		return
+	}
+	s.send(EventAcquire, data.Conn, nil)
+}
+
+func (s *eventSender) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	s.send(EventRelease, data.Conn, nil)
+}
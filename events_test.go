@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestEventChannelValidate(t *testing.T) {
+	if err := WithEventChannel(nil)(&options{}); err == nil {
+		t.Error("WithEventChannel accepted a nil channel")
+	}
+}
+
+func TestEventSenderDropsWhenFull(t *testing.T) {
+	ch := make(chan PoolEvent, 1)
+	s := &eventSender{ch: ch, name: "events"}
+	s.TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{Err: pgError("53300")})
+	s.TraceAcquireEnd(context.Background(), nil, pgxpool.TraceAcquireEndData{Err: pgError("53300")})
+	s.TraceRelease(nil, pgxpool.TraceReleaseData{})
+	if got := s.dropped.Load(); got != 2 {
+		t.Errorf("dropped = %d, want 2", got)
+	}
+	event := <-ch
+	if event.Type != EventError || event.Pool != "events" || !IsTooManyConnections(event.Err) || event.PID != 0 || event.Time.IsZero() {
+		t.Errorf("event = %+v, want the connect error of pool events", event)
+	}
+}
+
+func TestEventsOnFailedConnect(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	ch := make(chan PoolEvent, 1)
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithName("events"),
+		WithEventChannel(ch), WithAsyncStartupPing(1, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := p.Acquire(context.Background()); err == nil {
+			t.Fatal("Acquire succeeded against a server rejecting every login")
+		}
+	}
+	if event := <-ch; event.Type != EventError || event.Pool != "events" || !IsTooManyConnections(event.Err) {
+		t.Errorf("event = %+v, want a too_many_connections error", event)
+	}
+	if dropped := p.DroppedEvents(); dropped == 0 {
+		t.Error("DroppedEvents = 0 after more errors than the channel holds")
+	}
+}
+
+func TestEventsAfterQuery(t *testing.T) {
+	ch := make(chan PoolEvent, 16)
+	p := testPool(t, WithName("events"), WithEventChannel(ch))
+	// Drain what the startup ping sent, so only the query's events are left.
+	for len(ch) > 0 {
+		<-ch
+	}
+	ctx := testContext(t)
+	if _, err := Scalar[int](ctx, p, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	var types []EventType
+	for len(ch) > 0 {
+		event := <-ch
+		if event.Pool != "events" || event.PID == 0 {
+			t.Errorf("event = %+v, want pool events and a backend PID", event)
+		}
+		types = append(types, event.Type)
+	}
+	if len(types) != 2 || types[0] != EventAcquire || types[1] != EventRelease {
+		t.Errorf("events after a query = %v, want acquire and release", types)
+	}
+	if dropped := p.DroppedEvents(); dropped != 0 {
+		t.Errorf("DroppedEvents = %d with room in the channel, want 0", dropped)
+	}
+	if dropped := (&Pool{}).DroppedEvents(); dropped != 0 {
+		t.Errorf("DroppedEvents = %d without WithEventChannel, want 0", dropped)
+	}
+}
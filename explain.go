@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+const auto_explain_timeout = 30 * time.Second
+
+// auto_explain_concurrency caps the explains running at once, slow queries seen while it is reached are not explained.
+const auto_explain_concurrency = 2
+
+// AutoExplain is a debugging aid: when a SELECT takes longer than threshold, it is explained with EXPLAIN (ANALYZE false)
+// on another connection and the plan is logged at warn level through the configured logger. Only statements starting with
+// SELECT are explained, so data-modifying statements are never rerun. The plan reflects the moment of the EXPLAIN, not of the slow run.
+// At most two explains run at once so a burst of slow queries does not pile up more load; the others are skipped. Stopped by Close.
+func WithAutoExplain(threshold time.Duration) Option {
+	return func(options *options) error {
+		if threshold <= 0 {
+			return fmt.Errorf("auto explain threshold must be greater than zero")
+		}
+		tracer := &explainTracer{threshold: threshold, running: make(chan struct{}, auto_explain_concurrency)}
+		options.tracers = append(options.tracers, func(string) pgx.QueryTracer {
+			return tracer
+		})
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			tracer.pool.Store(p)
+			return nil
+		})
+		return nil
+	}
+}
+
+type explainTracer struct {
+	threshold time.Duration
+	pool      atomic.Pointer[Pool]
+	running   chan struct{} // one token per explain in progress
+}
+
+type explainQueryKey struct{}
+
+type explainQuery struct {
+	start time.Time
+	sql   string
+	args  []any
+}
+
+func (t *explainTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !isSelect(data.SQL) {
+		return ctx
+	}
+	return context.WithValue(ctx, explainQueryKey{}, &explainQuery{start: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (t *explainTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	query, ok := ctx.Value(explainQueryKey{}).(*explainQuery)
+	if !ok || data.Err != nil {
+		return
+	}
+	elapsed := time.Since(query.start)
+	p := t.pool.Load()
+	if elapsed < t.threshold || p == nil {
+		return
+	}
+	select {
+	case t.running <- struct{}{}:
+	default:
+		return
+	}
+	started := p.goBackground(func(ctx context.Context) {
+		defer func() { <-t.running }()
+		p.explainSlowQuery(ctx, query, elapsed)
+	})
+	if !started {
+		<-t.running
+	}
+}
+
+func (p *Pool) explainSlowQuery(ctx context.Context, query *explainQuery, elapsed time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, auto_explain_timeout)
+	defer cancel()
+	plan, err := Select[string](ctx, p.Pool, "EXPLAIN (ANALYZE false) "+query.sql, query.args...)
+	if err != nil {
+		p.log(ctx, tracelog.LogLevelWarn, "explain slow query", map[string]any{"sql": query.sql, "time": elapsed, "err": err})
+		return
+	}
+	p.log(ctx, tracelog.LogLevelWarn, "slow query plan", map[string]any{"sql": query.sql, "time": elapsed, "plan": strings.Join(plan, "\n")})
+}
+
+func isSelect(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	return len(sql) >= 6 && strings.EqualFold(sql[:6], "select")
+}
+
+// isReadOnlySelect reports whether sql starts with SELECT and has no INTO. The word is also found in literals and quoted
+// identifiers, refusing some harmless queries rather than risk running a SELECT INTO.
+func isReadOnlySelect(sql string) bool {
+	if !isSelect(sql) {
+		return false
+	}
+	words := strings.FieldsFunc(sql, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$'
+	})
+	for _, word := range words {
+		if strings.EqualFold(word, "into") {
+			return false
+		}
+	}
+	return true
+}
+
+// Explain returns the plan the server would use for the query sql with args, as printed by EXPLAIN. The query is not run.
+func Explain(ctx context.Context, db Querier, sql string, args ...any) (string, error) {
+	plan, err := Select[string](ctx, db, "EXPLAIN "+sql, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(plan, "\n"), nil
+}
+
+// ExplainAnalyze runs the query sql with args under EXPLAIN (ANALYZE, BUFFERS) and returns the plan with actual times and row counts.
+// The query really runs, with all its side effects, so only statements starting with SELECT and without INTO, which creates a
+// table, are accepted unless allowWrites is set. Functions with side effects called by an accepted SELECT still run and keep their
+// effects. To analyze a statement without keeping its changes, pass a *Tx as db and roll it back.
+func ExplainAnalyze(ctx context.Context, db Querier, allowWrites bool, sql string, args ...any) (string, error) {
+	if !allowWrites && !isReadOnlySelect(sql) {
+		return "", fmt.Errorf("explain analyze runs the statement, set allowWrites to analyze statements other than SELECT or with INTO")
+	}
+	plan, err := Select[string](ctx, db, "EXPLAIN (ANALYZE, BUFFERS) "+sql, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(plan, "\n"), nil
+}
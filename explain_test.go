@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestIsSelect(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT 1":                 true,
+		"  select * from users":    true,
+		"\n\tSeLeCt now()":         true,
+		"UPDATE users SET a = 1":   false,
+		"WITH x AS (SELECT 1) ...": false,
+		"sel":                      false,
+		"":                         false,
+	}
+	for sql, want := range tests {
+		if got := isSelect(sql); got != want {
+			t.Errorf("isSelect(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
+
+func slowQueryContext(elapsed time.Duration) context.Context {
+	return context.WithValue(context.Background(), explainQueryKey{}, &explainQuery{start: time.Now().Add(-elapsed), sql: "SELECT 1"})
+}
+
+func TestAutoExplainSkipsWhenBusy(t *testing.T) {
+	tracer := &explainTracer{threshold: time.Millisecond, running: make(chan struct{}, auto_explain_concurrency)}
+	p := &Pool{bg: context.Background()}
+	tracer.pool.Store(p)
+	for i := 0; i < auto_explain_concurrency; i++ {
+		tracer.running <- struct{}{}
+	}
+	// with every slot taken no explain may start, which would run against the nil pgxpool.Pool and panic
+	tracer.TraceQueryEnd(slowQueryContext(time.Second), nil, pgx.TraceQueryEndData{})
+	p.wg.Wait()
+	if len(tracer.running) != auto_explain_concurrency {
+		t.Errorf("%d explains running, want %d", len(tracer.running), auto_explain_concurrency)
+	}
+}
+
+func TestAutoExplainReleasesSlotWhenClosed(t *testing.T) {
+	tracer := &explainTracer{threshold: time.Millisecond, running: make(chan struct{}, auto_explain_concurrency)}
+	tracer.pool.Store(&Pool{bg: context.Background(), closed: true})
+	tracer.TraceQueryEnd(slowQueryContext(time.Second), nil, pgx.TraceQueryEndData{})
+	if len(tracer.running) != 0 {
+		t.Errorf("closed pool kept %d explain slots", len(tracer.running))
+	}
+}
+
+func TestAutoExplainIgnoresFastQueries(t *testing.T) {
+	tracer := &explainTracer{threshold: time.Hour, running: make(chan struct{}, auto_explain_concurrency)}
+	tracer.pool.Store(&Pool{bg: context.Background()})
+	tracer.TraceQueryEnd(slowQueryContext(time.Millisecond), nil, pgx.TraceQueryEndData{})
+	if len(tracer.running) != 0 {
+		t.Error("a query faster than the threshold took an explain slot")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	server.answer("EXPLAIN SELECT * FROM orders", []fakeColumn{{name: "QUERY PLAN", oid: pgtype.TextOID}},
+		[]any{"Seq Scan on orders  (cost=0.00..22.70 rows=1270 width=36)"}, []any{"  Filter: (id > 1)"})
+	plan, err := Explain(ctx, p, "SELECT * FROM orders")
+	if want := "Seq Scan on orders  (cost=0.00..22.70 rows=1270 width=36)\n  Filter: (id > 1)"; err != nil || plan != want {
+		t.Errorf("Explain = %q, %v, want %q", plan, err, want)
+	}
+}
+
+func TestExplainAnalyzeGuard(t *testing.T) {
+	ctx := context.Background()
+	for _, sql := range []string{"DELETE FROM orders", "WITH d AS (DELETE FROM orders RETURNING id) SELECT id FROM d", "",
+		"SELECT * INTO archive FROM orders", "select id\ninto TEMP t from orders"} {
+		q := &recordingQuerier{}
+		if _, err := ExplainAnalyze(ctx, q, false, sql); err == nil || len(q.sql) != 0 {
+			t.Errorf("ExplainAnalyze of %q without allowWrites = %v after sending %q, want an error before sending", sql, err, q.sql)
+		}
+	}
+	q := &recordingQuerier{}
+	_, _ = ExplainAnalyze(ctx, q, true, "DELETE FROM orders WHERE id = $1", 1)
+	if sql, args := q.last(t); sql != "EXPLAIN (ANALYZE, BUFFERS) DELETE FROM orders WHERE id = $1" || len(args) != 1 {
+		t.Errorf("ExplainAnalyze with allowWrites sent %s %v", sql, args)
+	}
+	q = &recordingQuerier{}
+	_, _ = ExplainAnalyze(ctx, q, false, " select 1")
+	if sql, _ := q.last(t); sql != "EXPLAIN (ANALYZE, BUFFERS)  select 1" {
+		t.Errorf("ExplainAnalyze of a SELECT sent %s", sql)
+	}
+	q = &recordingQuerier{}
+	_, _ = ExplainAnalyze(ctx, q, false, "SELECT into_date FROM orders")
+	if sql, _ := q.last(t); sql != "EXPLAIN (ANALYZE, BUFFERS) SELECT into_date FROM orders" {
+		t.Errorf("ExplainAnalyze of a SELECT with a column named like INTO sent %s", sql)
+	}
+}
+
+func TestExplainOnServer(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testTable(t, "explain", "id int8")
+	if _, err := p.Exec(ctx, "INSERT INTO "+table+" SELECT generate_series(1, 10)"); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Explain(ctx, p, "SELECT * FROM "+table+" WHERE id > $1", 5)
+	if err != nil || !strings.Contains(plan, "Scan") || strings.Contains(plan, "actual time") {
+		t.Errorf("Explain = %q, %v, want a plan without actual times", plan, err)
+	}
+	errRollback := errors.New("roll back")
+	err = p.WithTx(ctx, func(tx *Tx) error {
+		plan, err := ExplainAnalyze(ctx, tx, true, "DELETE FROM "+table)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(plan, "actual time") {
+			t.Errorf("ExplainAnalyze = %q, want actual times", plan)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatal(err)
+	}
+	if n, err := Count(ctx, p, table, ""); err != nil || n != 10 {
+		t.Errorf("%s has %d rows, %v after the rolled back analyze, want 10", table, n, err)
+	}
+}
@@ -0,0 +1,342 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CSVFormat controls how the CSV helpers read and write values.
+type CSVFormat struct {
+	// Null is the text used for SQL NULL values. Empty by default.
+	Null string
+	// Delimiter separates fields. Comma by default.
+	Delimiter rune
+	// Header reports that CSV input starts with a header row, which is skipped. Output always has a header row.
+	Header bool
+}
+
+// QueryCSV runs a query and writes its result to w as CSV: a header row with the column names followed by one row per result row.
+// It returns the number of data rows written.
+func QueryCSV(ctx context.Context, w io.Writer, db Querier, sql string, args ...any) (int64, error) {
+	cfg := configOf(db)
+	format := cfg.csv
+	sql, args = cfg.prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	if format.Delimiter != 0 {
+		cw.Comma = format.Delimiter
+	}
+	fields := rows.FieldDescriptions()
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = field.Name
+	}
+	if err := cw.Write(record); err != nil {
+		return 0, err
+	}
+	types := typeMapOf(rows)
+	var n int64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return n, err
+		}
+		for i, value := range values {
+			record[i] = formatValue(types, fields[i].DataTypeOID, value, format.Null)
+		}
+		if err := cw.Write(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// QueryJSONL runs a query and writes every result row to w as a JSON object keyed by column name, one object per line.
+// Values are marshaled from the Go values decoded by pgx and NULL is written as null. uuids, intervals and ranges, which
+// pgx decodes into values without a useful JSON form, are written as strings in PostgreSQL's text format.
+// It returns the number of rows written.
+func QueryJSONL(ctx context.Context, w io.Writer, db Querier, sql string, args ...any) (int64, error) {
+	sql, args = configOf(db).prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	fields := rows.FieldDescriptions()
+	types := typeMapOf(rows)
+	var n int64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return n, err
+		}
+		object := make(map[string]any, len(values))
+		for i, value := range values {
+			object[fields[i].Name] = jsonValue(types, fields[i].DataTypeOID, value)
+		}
+		if err := enc.Encode(object); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// formatValue formats a value decoded by rows.Values for CSV. Values without a plain Go form, such as uuids, ranges and arrays,
+// are written in PostgreSQL's text format using types, the connection's type map, and oid, the type of the column.
+func formatValue(types *pgtype.Map, oid uint32, value any, null string) string {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err == nil {
+			value = v
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case [16]byte:
+		return formatUUID(v)
+	case pgtype.RangeValuer:
+		return formatRange(types, v, null)
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		if text, ok := encodeText(types, oid, value); ok {
+			return text
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonValue converts a value decoded by rows.Values whose JSON encoding would be unreadable, such as a uuid as an array of
+// numbers, into its text form. types and oid are as for formatValue.
+func jsonValue(types *pgtype.Map, oid uint32, value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case [16]byte:
+		return formatUUID(v)
+	case []any:
+		converted := make([]any, len(v))
+		for i, element := range v {
+			converted[i] = jsonValue(types, 0, element)
+		}
+		return converted
+	case json.Marshaler:
+		return v
+	case pgtype.RangeValuer:
+		if v.IsNull() {
+			return nil
+		}
+		return formatRange(types, v, "")
+	case driver.Valuer:
+		if converted, err := v.Value(); err == nil {
+			return converted
+		}
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Struct {
+		if text, ok := encodeText(types, oid, value); ok {
+			return text
+		}
+	}
+	return value
+}
+
+// formatUUID formats the 16 bytes pgx decodes a uuid into in the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form.
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// formatRange formats a range in PostgreSQL's text format, e.g. [1,5), which pgx cannot encode for ranges decoded by rows.Values.
+func formatRange(types *pgtype.Map, r pgtype.RangeValuer, null string) string {
+	if r.IsNull() {
+		return null
+	}
+	lowerType, upperType := r.BoundTypes()
+	if lowerType == pgtype.Empty {
+		return "empty"
+	}
+	lower, upper := r.Bounds()
+	var b strings.Builder
+	if lowerType == pgtype.Inclusive {
+		b.WriteByte('[')
+	} else {
+		b.WriteByte('(')
+	}
+	if lowerType != pgtype.Unbounded {
+		b.WriteString(formatValue(types, 0, boundValue(lower), ""))
+	}
+	b.WriteByte(',')
+	if upperType != pgtype.Unbounded {
+		b.WriteString(formatValue(types, 0, boundValue(upper), ""))
+	}
+	if upperType == pgtype.Inclusive {
+		b.WriteByte(']')
+	} else {
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// boundValue dereferences a bound returned by pgtype.RangeValuer.Bounds, which points at the bound.
+func boundValue(bound any) any {
+	if v := reflect.ValueOf(bound); v.Kind() == reflect.Pointer && !v.IsNil() {
+		return v.Elem().Interface()
+	}
+	return bound
+}
+
+// encodeText returns value in PostgreSQL's text format for the type oid, or false if types cannot encode it.
+func encodeText(types *pgtype.Map, oid uint32, value any) (string, bool) {
+	if types == nil {
+		return "", false
+	}
+	buf, err := types.Encode(oid, pgtype.TextFormatCode, value, nil)
+	if err != nil || buf == nil {
+		return "", false
+	}
+	return string(buf), true
+}
+
+// typeMapOf returns the type map of the connection rows were read from, nil if it is not known.
+func typeMapOf(rows pgx.Rows) *pgtype.Map {
+	if conn := rows.Conn(); conn != nil {
+		return conn.TypeMap()
+	}
+	return nil
+}
+
+// CopyFromCSV loads CSV data read from r into table using COPY ... FROM STDIN, which is the fastest way to bulk-load a file.
+// columns lists the target columns in the order they appear in the CSV; if empty all columns of the table are used.
+// It returns the number of rows loaded.
+func (p *Pool) CopyFromCSV(ctx context.Context, r io.Reader, table string, columns []string) (int64, error) {
+	format := p.cfg.csv
+	var sql strings.Builder
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return 0, err
+	}
+	sql.WriteString("COPY " + quotedTable)
+	if len(columns) > 0 {
+		quotedCols, err := quoteIdents(columns)
+		if err != nil {
+			return 0, err
+		}
+		sql.WriteString(" (" + quotedCols + ")")
+	}
+	sql.WriteString(" FROM STDIN WITH (FORMAT csv, NULL " + quoteLiteral(format.Null))
+	if format.Delimiter != 0 {
+		sql.WriteString(", DELIMITER " + quoteLiteral(string(format.Delimiter)))
+	}
+	if format.Header {
+		sql.WriteString(", HEADER true")
+	}
+	sql.WriteString(")")
+
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+	copyFrom, _ := p.cfg.prepare(ctx, sql.String(), nil)
+	tag, err := conn.Conn().PgConn().CopyFrom(ctx, r, copyFrom)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CopyBetween streams the result of srcQuery on src into dstTable on dst, e.g. to migrate data between databases. It pipes
+// COPY ... TO STDOUT on src into COPY ... FROM STDIN on dst in the binary format, so the data is never buffered as a whole, and
+// returns the number of rows loaded. The query's columns must match dstColumns, or all columns of dstTable if it is empty, in order
+// and exactly in type, since binary data is not converted. If either side fails nothing is loaded and the first error is returned.
+func CopyBetween(ctx context.Context, src, dst *Pool, srcQuery, dstTable string, dstColumns []string) (int64, error) {
+	quotedTable, err := quoteTable(dstTable)
+	if err != nil {
+		return 0, err
+	}
+	copyFrom := "COPY " + quotedTable
+	if len(dstColumns) > 0 {
+		quotedCols, err := quoteIdents(dstColumns)
+		if err != nil {
+			return 0, err
+		}
+		copyFrom += " (" + quotedCols + ")"
+	}
+	copyFrom += " FROM STDIN (FORMAT binary)"
+
+	srcConn, err := src.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("source: %w", err)
+	}
+	defer srcConn.Release()
+	dstConn, err := dst.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("destination: %w", err)
+	}
+	defer dstConn.Release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The side failing first causes the other to fail too, so only its error is reported.
+	var failOnce sync.Once
+	var failed error
+	fail := func(side string, err error) {
+		failOnce.Do(func() { failed = fmt.Errorf("%s: %w", side, err) })
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := srcConn.Conn().PgConn().CopyTo(ctx, pw, "COPY ("+srcQuery+") TO STDOUT (FORMAT binary)")
+		if err != nil {
+			fail("source", err)
+		}
+		pw.CloseWithError(err)
+	}()
+	tag, err := dstConn.Conn().PgConn().CopyFrom(ctx, pr, copyFrom)
+	if err != nil {
+		fail("destination", err)
+		pr.CloseWithError(err)
+		cancel()
+	}
+	<-done
+	if failed != nil {
+		return 0, failed
+	}
+	return tag.RowsAffected(), nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
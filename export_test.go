@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestFormatValue(t *testing.T) {
+	types := pgtype.NewMap()
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		oid   uint32
+		value any
+		want  string
+	}{
+		{"null", pgtype.TextOID, nil, "NULL"},
+		{"string", pgtype.TextOID, "hello", "hello"},
+		{"bytes", pgtype.ByteaOID, []byte{0xde, 0xad}, `\xdead`},
+		{"time", pgtype.TimestamptzOID, at, "2024-05-01T12:30:00Z"},
+		{"int", pgtype.Int8OID, int64(42), "42"},
+		{"bool", pgtype.BoolOID, true, "true"},
+		{"uuid", pgtype.UUIDOID, [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}, "12345678-9abc-def0-1234-56789abcdef0"},
+		{"interval", pgtype.IntervalOID, pgtype.Interval{Days: 1, Microseconds: 2 * 3600 * 1000000, Valid: true}, "1 day 02:00:00"},
+		{"numeric", pgtype.NumericOID, pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true}, "123.45"},
+		{"range", pgtype.Int4rangeOID, pgtype.Range[any]{Lower: int32(1), Upper: int32(5), LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive, Valid: true}, "[1,5)"},
+		{"unbounded range", pgtype.DaterangeOID, pgtype.Range[any]{Lower: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), LowerType: pgtype.Inclusive, UpperType: pgtype.Unbounded, Valid: true}, "[2024-05-01T00:00:00Z,)"},
+		{"empty range", pgtype.Int4rangeOID, pgtype.Range[any]{LowerType: pgtype.Empty, UpperType: pgtype.Empty, Valid: true}, "empty"},
+		{"null range", pgtype.Int4rangeOID, pgtype.Range[any]{}, "NULL"},
+		{"array", pgtype.Int4ArrayOID, []any{int32(1), int32(2)}, "{1,2}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatValue(types, tt.oid, tt.value, "NULL"); got != tt.want {
+				t.Errorf("formatValue(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatValueWithoutTypeMap(t *testing.T) {
+	if got := formatValue(nil, pgtype.Int4ArrayOID, []any{int32(1)}, ""); got != "[1]" {
+		t.Errorf("formatValue without a type map = %q, want the fmt fallback [1]", got)
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	types := pgtype.NewMap()
+	id := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	tests := []struct {
+		name  string
+		oid   uint32
+		value any
+		want  string
+	}{
+		{"null", pgtype.TextOID, nil, `null`},
+		{"string", pgtype.TextOID, "hello", `"hello"`},
+		{"int", pgtype.Int4OID, int32(7), `7`},
+		{"uuid", pgtype.UUIDOID, id, `"12345678-9abc-def0-1234-56789abcdef0"`},
+		{"uuid array", pgtype.UUIDArrayOID, []any{id, nil}, `["12345678-9abc-def0-1234-56789abcdef0",null]`},
+		{"interval", pgtype.IntervalOID, pgtype.Interval{Days: 1, Microseconds: 2 * 3600 * 1000000, Valid: true}, `"1 day 02:00:00"`},
+		{"numeric", pgtype.NumericOID, pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true}, `123.45`},
+		{"range", pgtype.Int4rangeOID, pgtype.Range[any]{Lower: int32(1), Upper: int32(5), LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive, Valid: true}, `"[1,5)"`},
+		{"null range", pgtype.Int4rangeOID, pgtype.Range[any]{}, `null`},
+		{"time", pgtype.TimestamptzOID, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), `"2024-05-01T12:30:00Z"`},
+		{"json", pgtype.JSONBOID, map[string]any{"a": float64(1)}, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(jsonValue(types, tt.oid, tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("jsonValue(%#v) marshals to %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryCSV(t *testing.T) {
+	p := testPool(t)
+	var buf bytes.Buffer
+	n, err := QueryCSV(testContext(t), &buf, p, `SELECT 1 AS id, 'a,b' AS name, NULL::text AS note,
+		'12345678-9abc-def0-1234-56789abcdef0'::uuid AS uuid, int4range(1, 5) AS span
+		UNION ALL SELECT $1, 'c', 'x', NULL, NULL`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id,name,note,uuid,span\n1,\"a,b\",,12345678-9abc-def0-1234-56789abcdef0,\"[1,5)\"\n2,c,x,,\n"
+	if n != 2 || buf.String() != want {
+		t.Errorf("QueryCSV wrote %d rows:\n%s\nwant 2 rows:\n%s", n, buf.String(), want)
+	}
+}
+
+func TestQueryCSVFormat(t *testing.T) {
+	p := testPool(t, WithCSVFormat(CSVFormat{Null: "NULL", Delimiter: ';'}))
+	var buf bytes.Buffer
+	if _, err := QueryCSV(testContext(t), &buf, p, "SELECT 1 AS a, NULL::int AS b"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a;b\n1;NULL\n"; buf.String() != want {
+		t.Errorf("QueryCSV wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCopyFromCSVStatement(t *testing.T) {
+	server := newAcceptingServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := New(ctx, WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithCSVFormat(CSVFormat{Null: "NULL", Delimiter: ';', Header: true}),
+		WithQueryRewriter(func(_ context.Context, sql string) string { return sql + " /* loader */" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	drainQueries(server)
+	// The fake server answers COPY like an empty query, so only the statement is checked.
+	_, _ = p.CopyFromCSV(ctx, strings.NewReader(""), "sales.orders", []string{"id", "note"})
+	want := `COPY "sales"."orders" ("id", "note") FROM STDIN WITH (FORMAT csv, NULL 'NULL', DELIMITER ';', HEADER true) /* loader */`
+	if got := drainQueries(server); len(got) != 1 || got[0] != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestCopyFromCSV(t *testing.T) {
+	p := testPool(t, WithCSVFormat(CSVFormat{Null: "NULL", Delimiter: ';', Header: true}))
+	ctx := testContext(t)
+	table := testTable(t, "copy_csv", "id int, note text, amount numeric")
+	n, err := p.CopyFromCSV(ctx, strings.NewReader("id;note\n1;\"a;b\"\n2;NULL\n"), table, []string{"id", "note"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("CopyFromCSV loaded %d rows, want 2", n)
+	}
+	var buf bytes.Buffer
+	if _, err := QueryCSV(ctx, &buf, p, "SELECT id, note, amount FROM "+table+" ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "id;note;amount\n1;\"a;b\";NULL\n2;NULL;NULL\n"; buf.String() != want {
+		t.Errorf("loaded rows read back as %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCopyBetween(t *testing.T) {
+	src, dst := testPool(t), testPool(t)
+	ctx := testContext(t)
+	from := testTable(t, "copy_between_src", "id int8, note text, at timestamptz")
+	to := testTable(t, "copy_between_dst", "id int8, note text, at timestamptz, extra int4")
+	if _, err := src.Exec(ctx, "INSERT INTO "+from+" SELECT n, 'row ' || n, now() FROM generate_series(1, 1000) n"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := CopyBetween(ctx, src, dst, "SELECT id, note, at FROM "+from+" WHERE id % 2 = 0", to, []string{"id", "note", "at"})
+	if err != nil || n != 500 {
+		t.Fatalf("CopyBetween = %d, %v, want 500 rows", n, err)
+	}
+	same, err := Scalar[bool](ctx, dst, "SELECT NOT EXISTS (SELECT id, note, at FROM "+from+" WHERE id % 2 = 0 EXCEPT SELECT id, note, at FROM "+to+")")
+	if err != nil || !same {
+		t.Errorf("copied rows match the source: %t, %v", same, err)
+	}
+	if _, err := CopyBetween(ctx, src, dst, "SELECT * FROM "+from+"_missing", to, nil); err == nil || !strings.HasPrefix(err.Error(), "source: ") {
+		t.Errorf("CopyBetween of a failing query = %v, want a source error", err)
+	}
+	// Binary data is not converted, so int4 values do not load into the int8 column.
+	if _, err := CopyBetween(ctx, src, dst, "SELECT id::int4, note, at FROM "+from, to, []string{"id", "note", "at"}); err == nil {
+		t.Error("CopyBetween with mismatched column types succeeded")
+	}
+	if n, err := Count(ctx, dst, to, ""); err != nil || n != 500 {
+		t.Errorf("%s has %d rows, %v after the failed copies, want 500", to, n, err)
+	}
+}
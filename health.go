@@ -0,0 +1,231 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Pings connections that have been idle longer than threshold before handing them out. Connections that fail the ping are discarded
+// and another one is acquired instead. This costs a round trip on such acquires but avoids handing out connections that died while idle.
+// pgxpool already does this for connections idle longer than a second, so the option only tightens that to a threshold below one second.
+func WithValidateAfterIdle(threshold time.Duration) Option {
+	return func(options *options) error {
+		if threshold <= 0 {
+			return fmt.Errorf("validate after idle threshold must be greater than zero")
+		}
+		if threshold >= pgxpool_idle_ping {
+			return fmt.Errorf("validate after idle threshold must be less than %v, pgxpool already pings connections idle that long", pgxpool_idle_ping)
+		}
+		var released sync.Map
+		options.afterrelease = append(options.afterrelease, func(conn *pgx.Conn) bool {
+			released.Store(conn, time.Now())
+			return true
+		})
+		options.beforeacquire = append(options.beforeacquire, func(ctx context.Context, conn *pgx.Conn) bool {
+			since, ok := released.Load(conn)
+			if !ok || time.Since(since.(time.Time)) < threshold {
+				return true
+			}
+			return conn.Ping(ctx) == nil
+		})
+		options.beforeclose = append(options.beforeclose, func(conn *pgx.Conn) {
+			released.Delete(conn)
+		})
+		return nil
+	}
+}
+
+// pgxpool_idle_ping is the idle time after which pgxpool itself pings a connection before handing it out.
+const pgxpool_idle_ping = time.Second
+
+const wait_ready_interval = 10 * time.Millisecond
+
+// WaitReady blocks until the pool holds at least conns established connections, idle or acquired, or ctx is done.
+// It is useful after New with WithMinConns, since the pool creates the minimum connections in the background.
+func (p *Pool) WaitReady(ctx context.Context, conns int) error {
+	ticker := time.NewTicker(wait_ready_interval)
+	defer ticker.Stop()
+	for established(p.Stat()) < conns {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// established counts the connections that are usable, unlike TotalConns which includes connections still being established.
+func established(stat *pgxpool.Stat) int {
+	return int(stat.IdleConns() + stat.AcquiredConns())
+}
+
+// ErrNotReady is returned by Healthy while the startup ping of WithAsyncStartupPing has not succeeded yet.
+var ErrNotReady = errors.New("postgres: startup ping has not succeeded yet")
+
+type asyncPing struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// AsyncStartupPing makes New return the pool without waiting for the database. The startup ping is retried in the background
+// up to attempts times, waiting backoff between attempts. Once they are used up, every call to Healthy retries the ping itself
+// until it succeeds. Readiness is reported by Ready and Healthy.
+// Use it for services that must start even while the database is briefly unavailable.
+func WithAsyncStartupPing(attempts int, backoff time.Duration) Option {
+	return func(options *options) error {
+		if attempts <= 0 {
+			return fmt.Errorf("startup ping attempts must be greater than zero")
+		}
+		if backoff < 0 {
+			return fmt.Errorf("startup ping backoff cannot be less than zero")
+		}
+		options.asyncping = &asyncPing{attempts: attempts, backoff: backoff}
+		return nil
+	}
+}
+
+func (p *Pool) startupPing(ctx context.Context, attempts int, backoff time.Duration) {
+	for attempt := 1; ; attempt++ {
+		err := p.runStartup(ctx, attempt >= attempts)
+		p.recordHealth(err)
+		if err == nil || attempt >= attempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// runStartup runs the startup check and closes ready once it succeeds. last hands further attempts over to Healthy.
+// Healthy only runs it once the background attempts are over, and one call at a time.
+func (p *Pool) runStartup(ctx context.Context, last bool) error {
+	select {
+	case <-p.ready:
+		return nil
+	default:
+	}
+	err := p.startup(ctx)
+	p.startupMu.Lock()
+	defer p.startupMu.Unlock()
+	if err == nil {
+		close(p.ready)
+	}
+	p.startupErr = err
+	p.startupEnd = last
+	return err
+}
+
+// Ready returns a channel that is closed once the startup ping has succeeded. Without WithAsyncStartupPing it is already closed when New returns.
+func (p *Pool) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Healthy pings the database. Until the startup ping of WithAsyncStartupPing has succeeded it returns its last error, or ErrNotReady,
+// and once the background attempts are used up it retries the startup ping first. The result is recorded for LastHealth.
+func (p *Pool) Healthy(ctx context.Context) error {
+	err := p.healthy(ctx)
+	p.recordHealth(err)
+	return err
+}
+
+func (p *Pool) healthy(ctx context.Context) error {
+	if err := p.awaitStartup(ctx); err != nil {
+		return err
+	}
+	if err := p.Ping(ctx); err != nil {
+		return err
+	}
+	if p.maxLag > 0 {
+		return p.checkReplicationLag(ctx)
+	}
+	return nil
+}
+
+// awaitStartup reports whether the startup ping has succeeded, running it when the background attempts are used up.
+func (p *Pool) awaitStartup(ctx context.Context) error {
+	select {
+	case <-p.ready:
+		return nil
+	default:
+	}
+	p.startupMu.Lock()
+	retry, err := p.startupEnd, p.startupErr
+	p.startupMu.Unlock()
+	// a Healthy call already retrying reports for the others
+	if retry && p.startupRun.TryLock() {
+		err = p.runStartup(ctx, true)
+		p.startupRun.Unlock()
+	}
+	select {
+	case <-p.ready:
+		return nil
+	default:
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotReady, err)
+	}
+	return ErrNotReady
+}
+
+// ErrReplicationLag is returned by Healthy when a standby lags behind its primary by more than WithMaxReplicationLag.
+var ErrReplicationLag = errors.New("postgres: replication lag exceeds the maximum")
+
+// MaxReplicationLag makes Healthy report ErrReplicationLag when the server is a standby whose last replayed transaction is older
+// than maxLag while WAL received from the primary is still waiting to be replayed. A caught-up standby is healthy however old its
+// last transaction is, and a primary is never checked, so the option can be set on pools that may point at either.
+func WithMaxReplicationLag(maxLag time.Duration) Option {
+	return func(options *options) error {
+		if maxLag <= 0 {
+			return fmt.Errorf("max replication lag must be greater than zero")
+		}
+		options.maxreplicationlag = maxLag
+		return nil
+	}
+}
+
+// replication_lag_query returns whether the server is a standby with WAL left to replay and the age in seconds of its last
+// replayed transaction.
+const replication_lag_query = `SELECT pg_is_in_recovery() AND pg_last_wal_receive_lsn() IS DISTINCT FROM pg_last_wal_replay_lsn(),
+	coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)::float8`
+
+func (p *Pool) checkReplicationLag(ctx context.Context) error {
+	var lagging bool
+	var seconds float64
+	err := p.QueryRow(ctx, replication_lag_query).Scan(&lagging, &seconds)
+	if err != nil {
+		return fmt.Errorf("check replication lag: %w", err)
+	}
+	return replicationLagError(lagging, seconds, p.maxLag)
+}
+
+// replicationLagError judges the result of replication_lag_query.
+func replicationLagError(lagging bool, seconds float64, maxLag time.Duration) error {
+	if lag := time.Duration(seconds * float64(time.Second)); lagging && lag > maxLag {
+		return fmt.Errorf("%w: %s behind, maximum %s", ErrReplicationLag, lag.Round(time.Millisecond), maxLag)
+	}
+	return nil
+}
+
+// LastHealth returns the time and result of the last health check made by Healthy or the startup ping.
+// The time is zero if no check has run yet.
+func (p *Pool) LastHealth() (time.Time, error) {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	return p.healthAt, p.healthErr
+}
+
+func (p *Pool) recordHealth(err error) {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+	p.healthAt, p.healthErr = time.Now(), err
+}
@@ -0,0 +1,302 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestValidateAfterIdleThreshold(t *testing.T) {
+	for threshold, valid := range map[time.Duration]bool{
+		0:                      false,
+		-time.Millisecond:      false,
+		100 * time.Millisecond: true,
+		999 * time.Millisecond: true,
+		time.Second:            false,
+		time.Minute:            false,
+	} {
+		err := WithValidateAfterIdle(threshold)(&options{})
+		if (err == nil) != valid {
+			t.Errorf("WithValidateAfterIdle(%v) returned %v, want valid %v", threshold, err, valid)
+		}
+	}
+}
+
+func TestValidateAfterIdleSkipsRecentConnections(t *testing.T) {
+	var opt options
+	if err := WithValidateAfterIdle(500 * time.Millisecond)(&opt); err != nil {
+		t.Fatal(err)
+	}
+	// the zero connection is never pinged as long as it was released within the threshold
+	conn := &pgx.Conn{}
+	opt.afterrelease[0](conn)
+	if !opt.beforeacquire[0](context.Background(), conn) {
+		t.Error("recently released connection was rejected")
+	}
+	opt.beforeclose[0](conn)
+	if !opt.beforeacquire[0](context.Background(), conn) {
+		t.Error("connection never released through the pool was rejected")
+	}
+}
+
+func TestValidateAfterIdleDiscardsDeadConnections(t *testing.T) {
+	const threshold = 100 * time.Millisecond
+	p := testPool(t, WithMaxConns(1), WithValidateAfterIdle(threshold))
+	admin := testPool(t)
+	ctx := testContext(t)
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := BackendPID(conn)
+	conn.Release()
+	if err := admin.TerminateBackend(ctx, pid); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(threshold + 50*time.Millisecond)
+	conn, err = p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if BackendPID(conn) == pid {
+		t.Error("the terminated connection was handed out again")
+	}
+	if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+		t.Errorf("acquired connection is not usable: %v", err)
+	}
+}
+
+func TestStartupPingHandsOverToHealthy(t *testing.T) {
+	down := errors.New("connection refused")
+	var calls int
+	p := &Pool{ready: make(chan struct{})}
+	p.startup = func(context.Context) error {
+		calls++
+		return down
+	}
+	ctx := context.Background()
+	p.startupPing(ctx, 2, 0)
+	if calls != 2 {
+		t.Fatalf("startup ping ran %d times, want 2", calls)
+	}
+	if err := p.awaitStartup(ctx); !errors.Is(err, ErrNotReady) || !errors.Is(err, down) {
+		t.Errorf("awaitStartup returned %v while the database is down, want ErrNotReady with the ping error", err)
+	}
+	if calls != 3 {
+		t.Errorf("startup ping ran %d times, want a retry from awaitStartup once the attempts are used up", calls)
+	}
+	down = nil
+	if err := p.awaitStartup(ctx); err != nil {
+		t.Fatalf("awaitStartup returned %v once the database is up", err)
+	}
+	select {
+	case <-p.Ready():
+	default:
+		t.Error("Ready was not closed by the retry from awaitStartup")
+	}
+	if err := p.awaitStartup(ctx); err != nil || calls != 4 {
+		t.Errorf("awaitStartup after success returned %v and ran the startup ping %d times, want nil and 4", err, calls)
+	}
+}
+
+func TestAsyncStartupPingRecovers(t *testing.T) {
+	proxy := newTestProxy(t)
+	var hooks int
+	ctx := testContext(t)
+	p, err := New(ctx, append(testOptions(t), WithHost("127.0.0.1"), WithPort(proxy.port), WithAsyncStartupPing(2, 10*time.Millisecond),
+		WithStartupHook(func(context.Context, *Pool) error {
+			hooks++
+			return nil
+		}))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	// wait for the background attempts to be used up
+	for {
+		p.startupMu.Lock()
+		end := p.startupEnd
+		p.startupMu.Unlock()
+		if end {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.Healthy(ctx); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("Healthy returned %v while the database is down, want ErrNotReady", err)
+	}
+	proxy.up.Store(true)
+	if err := p.Healthy(ctx); err != nil {
+		t.Fatalf("Healthy returned %v once the database is up", err)
+	}
+	select {
+	case <-p.Ready():
+	default:
+		t.Error("Ready was not closed after Healthy succeeded")
+	}
+	if hooks != 1 {
+		t.Errorf("startup hook ran %d times, want 1", hooks)
+	}
+}
+
+func TestWaitReadyAfterWarmup(t *testing.T) {
+	server := newAcceptingServer(t)
+	const period = 300 * time.Millisecond
+	start := time.Now()
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithMinConns(3), WithHealthCheckPeriod(period), WithGradualWarmup(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.WaitReady(short, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitReady during the ramp = %v, want context.DeadlineExceeded", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.WaitReady(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	// Before the second ramp slot, period/3 in, only the startup ping's connection and the first ramp connection can exist.
+	if elapsed := time.Since(start); elapsed < period/3-10*time.Millisecond {
+		t.Errorf("WaitReady returned after %s, before the ramp could finish", elapsed)
+	}
+	if n := established(p.Stat()); n < 3 {
+		t.Errorf("%d connections established after WaitReady, want 3", n)
+	}
+}
+
+func TestLastHealth(t *testing.T) {
+	server := newAcceptingServer(t)
+	before := time.Now()
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := p.LastHealth()
+	if err != nil || at.Before(before) {
+		t.Errorf("LastHealth after New = %s, %v, want the startup ping's success", at, err)
+	}
+	if err := p.Healthy(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checked, err := p.LastHealth()
+	if err != nil || !checked.After(at) {
+		t.Errorf("LastHealth after Healthy = %s, %v, want a success later than %s", checked, err, at)
+	}
+	p.Close()
+	healthErr := p.Healthy(context.Background())
+	if healthErr == nil {
+		t.Fatal("Healthy succeeded on a closed pool")
+	}
+	if failed, err := p.LastHealth(); err != healthErr || !failed.After(checked) {
+		t.Errorf("LastHealth after a failed Healthy = %s, %v, want %v later than %s", failed, err, healthErr, checked)
+	}
+}
+
+func TestLastHealthAsyncStartup(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithAsyncStartupPing(1, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	// The single background attempt fails; its result is recorded once it has run.
+	deadline := time.Now().Add(time.Second)
+	for {
+		at, err := p.LastHealth()
+		if !at.IsZero() {
+			if !IsTooManyConnections(err) {
+				t.Errorf("LastHealth after the failed startup ping = %v, want its error", err)
+			}
+			break
+		}
+		if err != nil {
+			t.Errorf("LastHealth has an error %v without a time", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the startup ping result was never recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := p.Healthy(context.Background()); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Healthy = %v, want ErrNotReady", err)
+	}
+	if _, err := p.LastHealth(); !errors.Is(err, ErrNotReady) {
+		t.Errorf("LastHealth after Healthy = %v, want ErrNotReady", err)
+	}
+}
+
+func TestReplicationLagError(t *testing.T) {
+	tests := []struct {
+		name    string
+		lagging bool
+		seconds float64
+		want    error
+	}{
+		{"primary", false, 0, nil},
+		{"caught up standby with an old last transaction", false, 3600, nil},
+		{"replaying within the maximum", true, 4.5, nil},
+		{"replaying at the maximum", true, 5, nil},
+		{"replaying behind the maximum", true, 12.3456, ErrReplicationLag},
+	}
+	for _, tt := range tests {
+		err := replicationLagError(tt.lagging, tt.seconds, 5*time.Second)
+		if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+			t.Errorf("%s: replicationLagError = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	err := replicationLagError(true, 12.3456, 5*time.Second)
+	if want := "postgres: replication lag exceeds the maximum: 12.346s behind, maximum 5s"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+	if err := WithMaxReplicationLag(0)(&options{}); err == nil {
+		t.Error("WithMaxReplicationLag accepted zero")
+	}
+}
+
+func TestMaxReplicationLagOnStandby(t *testing.T) {
+	server := newAcceptingServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := New(ctx, WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithMaxReplicationLag(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.Healthy(ctx); err == nil || errors.Is(err, ErrReplicationLag) {
+		t.Errorf("Healthy with a failing lag query = %v, want the query error", err)
+	}
+	columns := []fakeColumn{{name: "lagging", oid: pgtype.BoolOID}, {name: "seconds", oid: pgtype.Float8OID}}
+	server.answer(replication_lag_query, columns, []any{true, 12.5})
+	if err := p.Healthy(ctx); !errors.Is(err, ErrReplicationLag) {
+		t.Errorf("Healthy 12.5s behind = %v, want ErrReplicationLag", err)
+	}
+	server.answer(replication_lag_query, columns, []any{true, 1.5})
+	if err := p.Healthy(ctx); err != nil {
+		t.Errorf("Healthy 1.5s behind = %v, want nil", err)
+	}
+}
+
+func TestMaxReplicationLagOnPrimary(t *testing.T) {
+	p := testPool(t, WithMaxReplicationLag(time.Millisecond))
+	ctx := testContext(t)
+	standby, err := Scalar[bool](ctx, p, "SELECT pg_is_in_recovery()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standby {
+		t.Skip("the test database is a standby")
+	}
+	if err := p.Healthy(ctx); err != nil {
+		t.Errorf("Healthy on a primary with a 1ms lag limit = %v, want nil", err)
+	}
+}
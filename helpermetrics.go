@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HelperRecorder receives the measurements of WithHelperMetrics. name is the query name set with WithQueryName, "" if there is none.
+// Implementations must be fast and safe for concurrent use; they typically feed a counter and a histogram labelled by name.
+type HelperRecorder interface {
+	// RecordQuery is called once per statement, after its result has been read or the statement has failed.
+	RecordQuery(ctx context.Context, name string, duration time.Duration, err error)
+	// RecordTx is called once per WithTx call, including retries, with the error returned to the caller.
+	RecordTx(ctx context.Context, name string, duration time.Duration, err error)
+}
+
+// HelperMetrics reports the duration and outcome of every statement run on the pool, whether through the package helpers or
+// Exec and Query, and of every WithTx call to recorder. Name the calls with WithQueryName for per-query rate, error and duration metrics.
+func WithHelperMetrics(recorder HelperRecorder) Option {
+	return func(options *options) error {
+		if recorder == nil {
+			return fmt.Errorf("helper metrics recorder cannot be nil")
+		}
+		tracer := &helperMetricsTracer{recorder: recorder}
+		options.tracers = append(options.tracers, func(string) pgx.QueryTracer {
+			return tracer
+		})
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			p.recorder = recorder
+			return nil
+		})
+		return nil
+	}
+}
+
+type helperMetricsTracer struct {
+	recorder HelperRecorder
+}
+
+type helperMetricsStartKey struct{}
+
+func (t *helperMetricsTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, helperMetricsStartKey{}, time.Now())
+}
+
+func (t *helperMetricsTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if start, ok := ctx.Value(helperMetricsStartKey{}).(time.Time); ok {
+		t.recorder.RecordQuery(ctx, QueryName(ctx), time.Since(start), data.Err)
+	}
+}
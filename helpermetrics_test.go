@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type recordedCall struct {
+	kind     string
+	name     string
+	duration time.Duration
+	err      error
+}
+
+// callRecorder is a HelperRecorder keeping every call.
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []recordedCall
+}
+
+func (r *callRecorder) RecordQuery(_ context.Context, name string, duration time.Duration, err error) {
+	r.record(recordedCall{"query", name, duration, err})
+}
+
+func (r *callRecorder) RecordTx(_ context.Context, name string, duration time.Duration, err error) {
+	r.record(recordedCall{"tx", name, duration, err})
+}
+
+func (r *callRecorder) record(call recordedCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+// named returns the calls recorded under name.
+func (r *callRecorder) named(name string) []recordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []recordedCall
+	for _, call := range r.calls {
+		if call.name == name {
+			found = append(found, call)
+		}
+	}
+	return found
+}
+
+func TestHelperMetricsTracer(t *testing.T) {
+	var recorder callRecorder
+	tracer := &helperMetricsTracer{recorder: &recorder}
+	ctx := tracer.TraceQueryStart(WithQueryName(context.Background(), "users.get"), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	time.Sleep(time.Millisecond)
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errRecorded})
+	// An end without a start, e.g. from another tracer's context, is not recorded.
+	tracer.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+	calls := recorder.named("users.get")
+	if len(recorder.calls) != 1 || len(calls) != 1 {
+		t.Fatalf("recorded %v, want one call for users.get", recorder.calls)
+	}
+	if call := calls[0]; call.kind != "query" || call.duration < time.Millisecond || !errors.Is(call.err, errRecorded) {
+		t.Errorf("recorded %+v, want the query with its duration and error", call)
+	}
+	if err := WithHelperMetrics(nil)(&options{}); err == nil {
+		t.Error("WithHelperMetrics accepted a nil recorder")
+	}
+}
+
+func TestHelperMetricsAfterHelpers(t *testing.T) {
+	var recorder callRecorder
+	p := testPool(t, WithHelperMetrics(&recorder))
+	ctx := WithQueryName(testContext(t), "metrics.scalar")
+	if _, err := Scalar[int](ctx, p, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := recorder.named("metrics.scalar"); len(calls) != 1 || calls[0].kind != "query" || calls[0].err != nil {
+		t.Errorf("recorded %+v after Scalar, want one successful query", calls)
+	}
+	ctx = WithQueryName(testContext(t), "metrics.tx")
+	err := p.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1/0")
+		return err
+	})
+	if err == nil {
+		t.Fatal("division by zero succeeded")
+	}
+	var queries, txs int
+	for _, call := range recorder.named("metrics.tx") {
+		switch call.kind {
+		case "query":
+			queries++
+		case "tx":
+			txs++
+			if call.err == nil {
+				t.Error("RecordTx got no error for a failed transaction")
+			}
+		}
+	}
+	if queries == 0 || txs != 1 {
+		t.Errorf("recorded %d queries and %d transactions for WithTx, want the statements and one transaction", queries, txs)
+	}
+}
@@ -0,0 +1,296 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Querier is the set of methods used by the package helpers. It is implemented by *Pool, *Session, *Tx, *pgxpool.Conn and pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+type helperConfig struct {
+	nullAsZero bool
+	csv        CSVFormat
+	retryable  func(error) bool
+	txRetries  int
+	tagCaller  bool
+	rewrite    func(ctx context.Context, sql string) string
+	formats    pgx.QueryResultFormats
+}
+
+type helperConfigurer interface {
+	helpers() *helperConfig
+}
+
+// configOf returns the helper configuration of db, or the defaults when db is not created by this package.
+func configOf(db Querier) *helperConfig {
+	if h, ok := db.(helperConfigurer); ok {
+		return h.helpers()
+	}
+	return &helperConfig{retryable: DefaultRetryPredicate}
+}
+
+// prepareQuery is prepare for statements sent with Query or QueryRow, which also accept result format arguments.
+func (c *helperConfig) prepareQuery(ctx context.Context, sql string, args []any) (string, []any) {
+	sql, args = c.prepare(ctx, sql, args)
+	if c.formats != nil {
+		args = append([]any{c.formats}, args...)
+	}
+	return sql, args
+}
+
+// prepare applies the configured statement transformations before a helper sends sql.
+func (c *helperConfig) prepare(ctx context.Context, sql string, args []any) (string, []any) {
+	if c.rewrite != nil {
+		sql = c.rewrite(ctx, sql)
+	}
+	if c.tagCaller {
+		sql = tagCaller(sql)
+	}
+	if mode, ok := ctx.Value(queryModeKey{}).(pgx.QueryExecMode); ok {
+		args = append([]any{mode}, args...)
+	}
+	return sql, args
+}
+
+type queryModeKey struct{}
+
+// WithQueryMode returns a context making the package helpers send their statements with mode instead of the pool's
+// default exec mode, e.g. pgx.QueryExecModeExec for one query whose best plan depends on its arguments.
+// Statements run directly on the pool, a Session or a Tx are not affected; pass the mode as their first argument instead.
+func WithQueryMode(ctx context.Context, mode pgx.QueryExecMode) context.Context {
+	return context.WithValue(ctx, queryModeKey{}, mode)
+}
+
+var packagePath = reflect.TypeOf(helperConfig{}).PkgPath()
+
+// tagCaller appends the first caller outside this package as a SQL comment.
+func tagCaller(sql string) string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePath+".") {
+			tag := fmt.Sprintf("%s %s:%d", frame.Function, filepath.Base(frame.File), frame.Line)
+			return sql + "\n/* " + strings.ReplaceAll(tag, "*/", "* /") + " */"
+		}
+		if !more {
+			return sql
+		}
+	}
+}
+
+// Scalar runs a query returning exactly one column of one row and scans it into T. ErrNoRows is returned if there are no rows.
+func Scalar[T any](ctx context.Context, db Querier, sql string, args ...any) (T, error) {
+	var zero T
+	cfg := configOf(db)
+	sql, args = cfg.prepareQuery(ctx, sql, args)
+	if cfg.nullAsZero {
+		var value *T
+		if err := db.QueryRow(ctx, sql, args...).Scan(&value); err != nil {
+			return zero, err
+		}
+		if value == nil {
+			return zero, nil
+		}
+		return *value, nil
+	}
+	var value T
+	if err := db.QueryRow(ctx, sql, args...).Scan(&value); err != nil {
+		return zero, err
+	}
+	return value, nil
+}
+
+// Select runs a query and collects all rows into a slice of T. Structs are mapped by column name, other types are scanned from a single column.
+func Select[T any](ctx context.Context, db Querier, sql string, args ...any) ([]T, error) {
+	cfg := configOf(db)
+	sql, args = cfg.prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, rowTo[T](cfg.nullAsZero))
+}
+
+// SelectWithTag is Select also returning the command tag of the statement, e.g. to read the number of rows affected by an
+// INSERT ... RETURNING or UPDATE ... RETURNING along with the returned rows. The tag of an upsert counts inserted and updated rows
+// together; return (xmax = 0) AS inserted to tell them apart.
+func SelectWithTag[T any](ctx context.Context, db Querier, sql string, args ...any) ([]T, pgconn.CommandTag, error) {
+	cfg := configOf(db)
+	sql, args = cfg.prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, pgconn.CommandTag{}, err
+	}
+	values, err := pgx.CollectRows(rows, rowTo[T](cfg.nullAsZero))
+	if err != nil {
+		return nil, pgconn.CommandTag{}, err
+	}
+	return values, rows.CommandTag(), nil
+}
+
+// Get runs a query and scans its first row into T like Select. ErrNoRows is returned if there are no rows.
+func Get[T any](ctx context.Context, db Querier, sql string, args ...any) (T, error) {
+	cfg := configOf(db)
+	sql, args = cfg.prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return pgx.CollectOneRow(rows, rowTo[T](cfg.nullAsZero))
+}
+
+// SelectMap runs a query like Select and returns the rows keyed by keyFn. When several rows have the same key the last one wins.
+func SelectMap[K comparable, T any](ctx context.Context, db Querier, keyFn func(T) K, sql string, args ...any) (map[K]T, error) {
+	rows, err := Select[T](ctx, db, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[K]T, len(rows))
+	for _, row := range rows {
+		result[keyFn(row)] = row
+	}
+	return result, nil
+}
+
+// GetOr is Get returning notFound instead of ErrNoRows when there are no rows. Other errors are returned unchanged.
+func GetOr[T any](ctx context.Context, db Querier, notFound error, sql string, args ...any) (T, error) {
+	value, err := Get[T](ctx, db, sql, args...)
+	if errors.Is(err, ErrNoRows) {
+		return value, notFound
+	}
+	return value, err
+}
+
+// SelectByPos is Select mapping columns to struct fields by position (see pgx.RowToStructByPos) instead of by name.
+// Use it for queries whose columns cannot easily be aliased to the field names, e.g. bare expressions; prefer Select otherwise,
+// since positional mapping silently breaks when the column or field order changes.
+func SelectByPos[T any](ctx context.Context, db Querier, sql string, args ...any) ([]T, error) {
+	sql, args = configOf(db).prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[T])
+}
+
+// GetByPos is Get mapping columns to struct fields by position, see SelectByPos. ErrNoRows is returned if there are no rows.
+func GetByPos[T any](ctx context.Context, db Querier, sql string, args ...any) (T, error) {
+	sql, args = configOf(db).prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return pgx.CollectOneRow(rows, pgx.RowToStructByPos[T])
+}
+
+// ScanArray runs a query returning one array column of one row, e.g. int[] or text[], and returns its elements.
+// T is any element type pgx can scan, such as int32, int64, float64, string, bool, time.Time or []byte. NULL elements are
+// returned as the zero value and a NULL array as a nil slice; to tell NULL elements apart, scan into []*T with Scalar or Get.
+// Select and Get map array columns to slice fields or values the same way, but fail on NULL elements unless the slice holds pointers.
+func ScanArray[T any](ctx context.Context, db Querier, sql string, args ...any) ([]T, error) {
+	elements, err := Scalar[[]*T](ctx, db, sql, args...)
+	if err != nil || elements == nil {
+		return nil, err
+	}
+	values := make([]T, len(elements))
+	for i, element := range elements {
+		if element != nil {
+			values[i] = *element
+		}
+	}
+	return values, nil
+}
+
+// Exists runs a query such as "SELECT EXISTS(...)" and returns its boolean result.
+func Exists(ctx context.Context, db Querier, sql string, args ...any) (bool, error) {
+	return Scalar[bool](ctx, db, sql, args...)
+}
+
+// QueryEach runs a query and calls fn for every row as it is received, without buffering the result. fn scans the row itself.
+// If fn returns an error, iteration stops, the rest of the result is discarded, the connection is released and the error is returned.
+func QueryEach(ctx context.Context, db Querier, sql string, args []any, fn func(row pgx.Row) error) error {
+	sql, args = configOf(db).prepareQuery(ctx, sql, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Count returns the number of rows of table, which may be schema-qualified, matching where, e.g. "status = $1".
+// where is added to the SQL verbatim; an empty where counts all rows.
+func Count(ctx context.Context, db Querier, table string, where string, args ...any) (int64, error) {
+	quoted, err := quoteTable(table)
+	if err != nil {
+		return 0, err
+	}
+	sql := "SELECT count(*) FROM " + quoted
+	if where = strings.TrimSpace(where); where != "" {
+		sql += " WHERE " + where
+	}
+	return Scalar[int64](ctx, db, sql, args...)
+}
+
+// CountQuery returns the number of rows returned by the query sql, usually the unpaginated form of a paged query.
+func CountQuery(ctx context.Context, db Querier, sql string, args ...any) (int64, error) {
+	return Scalar[int64](ctx, db, "SELECT count(*) FROM ("+sql+") AS q", args...)
+}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	scannerType      = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	rangeScannerType = reflect.TypeOf((*pgtype.RangeScanner)(nil)).Elem()
+)
+
+// rowTo returns the row mapper used by the helpers: structs are mapped by column name (see pgx.RowToStructByName),
+// any other type is scanned from a single column, with NULL scanned as the zero value if nullAsZero is set.
+func rowTo[T any](nullAsZero bool) pgx.RowToFunc[T] {
+	if isRowStruct(reflect.TypeOf((*T)(nil)).Elem()) {
+		return pgx.RowToStructByName[T]
+	}
+	if nullAsZero {
+		return func(row pgx.CollectableRow) (T, error) {
+			var value *T
+			if err := row.Scan(&value); err != nil || value == nil {
+				var zero T
+				return zero, err
+			}
+			return *value, nil
+		}
+	}
+	return pgx.RowTo[T]
+}
+
+func isRowStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	ptr := reflect.PointerTo(t)
+	return !ptr.Implements(scannerType) && !ptr.Implements(rangeScannerType)
+}
@@ -0,0 +1,492 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errRecorded = errors.New("statement recorded, not sent")
+
+// recordingQuerier is a Querier that records the statements the helpers send instead of running them. The helpers apply cfg, if set,
+// as they do the configuration of a Pool.
+type recordingQuerier struct {
+	cfg  *helperConfig
+	sql  []string
+	args [][]any
+}
+
+func (q *recordingQuerier) helpers() *helperConfig {
+	if q.cfg == nil {
+		return &helperConfig{retryable: DefaultRetryPredicate}
+	}
+	return q.cfg
+}
+
+func (q *recordingQuerier) record(sql string, args []any) {
+	q.sql = append(q.sql, sql)
+	q.args = append(q.args, args)
+}
+
+func (q *recordingQuerier) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q.record(sql, args)
+	return pgconn.CommandTag{}, errRecorded
+}
+
+func (q *recordingQuerier) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.record(sql, args)
+	return nil, errRecorded
+}
+
+func (q *recordingQuerier) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	q.record(sql, args)
+	return failedRow{err: errRecorded}
+}
+
+func (q *recordingQuerier) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, _ pgx.CopyFromSource) (int64, error) {
+	q.record(table.Sanitize(), []any{columns})
+	return 0, errRecorded
+}
+
+// failedRow is a pgx.Row failing every scan with err.
+type failedRow struct {
+	err error
+}
+
+func (r failedRow) Scan(...any) error {
+	return r.err
+}
+
+// last returns the last statement recorded by q.
+func (q *recordingQuerier) last(t *testing.T) (string, []any) {
+	t.Helper()
+	if len(q.sql) == 0 {
+		t.Fatal("no statement was sent")
+	}
+	return q.sql[len(q.sql)-1], q.args[len(q.args)-1]
+}
+
+func TestScalarSendsStatement(t *testing.T) {
+	q := &recordingQuerier{}
+	if _, err := Scalar[int](context.Background(), q, "SELECT $1::int", 7); !errors.Is(err, errRecorded) {
+		t.Fatalf("Scalar returned %v, want the query error", err)
+	}
+	sql, args := q.last(t)
+	if sql != "SELECT $1::int" || len(args) != 1 || args[0] != 7 {
+		t.Errorf("Scalar sent %q %v", sql, args)
+	}
+}
+
+func TestScalar(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	n, err := Scalar[int](ctx, p, "SELECT $1::int + 1", 41)
+	if err != nil || n != 42 {
+		t.Errorf("Scalar = %d, %v, want 42", n, err)
+	}
+	s, err := Scalar[string](ctx, p, "SELECT 'hello'")
+	if err != nil || s != "hello" {
+		t.Errorf("Scalar = %q, %v, want hello", s, err)
+	}
+	ptr, err := Scalar[*int](ctx, p, "SELECT NULL::int")
+	if err != nil || ptr != nil {
+		t.Errorf("Scalar of NULL into *int = %v, %v, want nil", ptr, err)
+	}
+	if _, err := Scalar[int](ctx, p, "SELECT NULL::int"); err == nil {
+		t.Error("Scalar of NULL into int succeeded without WithNullAsZero")
+	}
+	if _, err := Scalar[int](ctx, p, "SELECT 1 WHERE false"); !errors.Is(err, ErrNoRows) {
+		t.Errorf("Scalar without rows returned %v, want ErrNoRows", err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	tests := []struct {
+		sql  string
+		args []any
+		want bool
+	}{
+		{"SELECT EXISTS(SELECT 1)", nil, true},
+		{"SELECT EXISTS(SELECT 1 WHERE false)", nil, false},
+		{"SELECT EXISTS(SELECT 1 WHERE $1::text = 'a')", []any{"a"}, true},
+		{"SELECT EXISTS(SELECT 1 WHERE $1::text = 'a')", []any{"b"}, false},
+	}
+	for _, tt := range tests {
+		got, err := Exists(ctx, p, tt.sql, tt.args...)
+		if err != nil || got != tt.want {
+			t.Errorf("Exists(%q, %v) = %v, %v, want %v", tt.sql, tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestNullAsZero(t *testing.T) {
+	p := testPool(t, WithNullAsZero())
+	ctx := testContext(t)
+	n, err := Scalar[int](ctx, p, "SELECT NULL::int")
+	if err != nil || n != 0 {
+		t.Errorf("Scalar of NULL = %d, %v, want 0", n, err)
+	}
+	s, err := Get[string](ctx, p, "SELECT NULL::text")
+	if err != nil || s != "" {
+		t.Errorf("Get of NULL = %q, %v, want an empty string", s, err)
+	}
+	values, err := Select[int](ctx, p, "SELECT v FROM (VALUES (1), (NULL), (3)) AS t(v)")
+	if err != nil || len(values) != 3 || values[0] != 1 || values[1] != 0 || values[2] != 3 {
+		t.Errorf("Select with a NULL row = %v, %v, want [1 0 3]", values, err)
+	}
+	ptr, err := Scalar[*int](ctx, p, "SELECT NULL::int")
+	if err != nil || ptr != nil {
+		t.Errorf("Scalar of NULL into *int = %v, %v, want nil", ptr, err)
+	}
+	if _, err := Scalar[int](ctx, p, "SELECT 1 WHERE false"); !errors.Is(err, ErrNoRows) {
+		t.Errorf("Scalar without rows returned %v, want ErrNoRows", err)
+	}
+}
+
+func TestNullWithoutNullAsZero(t *testing.T) {
+	p := testPool(t)
+	if _, err := Select[int](testContext(t), p, "SELECT v FROM (VALUES (1), (NULL)) AS t(v)"); err == nil {
+		t.Error("Select scanned NULL into int without WithNullAsZero")
+	}
+}
+
+func TestCallerTagging(t *testing.T) {
+	server := newAcceptingServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := New(ctx, WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithCallerTagging())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	drainQueries(server)
+	if _, err := Scalar[int](ctx, p, "SELECT 1"); err == nil {
+		t.Fatal("Scalar succeeded without a result from the server")
+	}
+	if _, err := p.Exec(ctx, "SELECT 2"); err != nil {
+		t.Fatal(err)
+	}
+	queries := drainQueries(server)
+	if len(queries) != 2 {
+		t.Fatalf("server received %q, want the two statements", queries)
+	}
+	// The test is inside the package, so the first caller outside it is the testing package running it.
+	tagged := regexp.MustCompile(`^SELECT 1\n/\* testing\.tRunner testing\.go:\d+ \*/$`)
+	if !tagged.MatchString(queries[0]) {
+		t.Errorf("Scalar sent %q, want the caller appended as a comment", queries[0])
+	}
+	if queries[1] != "SELECT 2" {
+		t.Errorf("Exec on the pool sent %q, want it untagged", queries[1])
+	}
+}
+
+func TestQueryRewriter(t *testing.T) {
+	if err := WithQueryRewriter(nil)(&options{}); err == nil {
+		t.Error("WithQueryRewriter accepted nil")
+	}
+	const comment = " /* service=orders */"
+	q := &recordingQuerier{cfg: &helperConfig{retryable: DefaultRetryPredicate, rewrite: func(_ context.Context, sql string) string {
+		return sql + comment
+	}}}
+	ctx := context.Background()
+	helpers := map[string]func() error{
+		"Scalar": func() error { _, err := Scalar[int](ctx, q, "SELECT 1"); return err },
+		"Select": func() error { _, err := Select[testOrder](ctx, q, "SELECT 1"); return err },
+		"SelectWithTag": func() error {
+			_, _, err := SelectWithTag[testOrder](ctx, q, "SELECT 1")
+			return err
+		},
+		"Get":   func() error { _, err := Get[testOrder](ctx, q, "SELECT 1"); return err },
+		"GetOr": func() error { _, err := GetOr[testOrder](ctx, q, ErrNoRows, "SELECT 1"); return err },
+		"SelectMap": func() error {
+			_, err := SelectMap(ctx, q, func(o testOrder) int64 { return o.ID }, "SELECT 1")
+			return err
+		},
+		"SelectByPos": func() error { _, err := SelectByPos[testOrder](ctx, q, "SELECT 1"); return err },
+		"GetByPos":    func() error { _, err := GetByPos[testOrder](ctx, q, "SELECT 1"); return err },
+		"ScanArray":   func() error { _, err := ScanArray[int](ctx, q, "SELECT 1"); return err },
+		"Exists":      func() error { _, err := Exists(ctx, q, "SELECT 1"); return err },
+		"QueryEach":   func() error { return QueryEach(ctx, q, "SELECT 1", nil, func(pgx.Row) error { return nil }) },
+		"Count":       func() error { _, err := Count(ctx, q, "orders", ""); return err },
+		"CountQuery":  func() error { _, err := CountQuery(ctx, q, "SELECT 1"); return err },
+		"Insert":      func() error { _, err := Insert(ctx, q, "orders", testOrder{}); return err },
+		"Upsert": func() error {
+			_, err := Upsert(ctx, q, "orders", OnConflictColumns("id"), testOrder{})
+			return err
+		},
+		"InsertReturning": func() error { _, err := InsertReturning[int](ctx, q, "SELECT 1"); return err },
+		"UpdateIfVersion": func() error {
+			return UpdateIfVersion(ctx, q, "orders", 1, 1, map[string]any{"customerName": "ann"})
+		},
+		"ExecScript": func() error { return ExecScript(ctx, q, "SELECT 1") },
+		"SelectByCompositeKeys": func() error {
+			_, err := SelectByCompositeKeys[testOrder](ctx, q, "orders", []string{"id"}, [][]any{{1}})
+			return err
+		},
+	}
+	for name, helper := range helpers {
+		q.sql = nil
+		if err := helper(); !errors.Is(err, errRecorded) {
+			t.Errorf("%s returned %v, want the statement error", name, err)
+			continue
+		}
+		if sql, _ := q.last(t); !strings.HasSuffix(sql, comment) || strings.Count(sql, comment) != 1 {
+			t.Errorf("%s sent %q, want the comment appended once", name, sql)
+		}
+	}
+	server := newAcceptingServer(t)
+	p, err := New(ctx, WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithQueryRewriter(func(_ context.Context, sql string) string { return sql + comment }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	drainQueries(server)
+	_, _ = Exists(ctx, p, "SELECT 1")
+	if _, err := p.Exec(ctx, "SELECT 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := drainQueries(server), []string{"SELECT 1" + comment, "SELECT 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q: helpers rewritten, the pool's own methods not", got, want)
+	}
+}
+
+func TestWithQueryMode(t *testing.T) {
+	server := newAcceptingServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := New(ctx, WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	server.answer("SELECT  '7' ::int", []fakeColumn{{name: "int4", oid: pgtype.Int4OID}}, []any{7})
+	drainQueries(server)
+	// The simple protocol interpolates the argument, so the server sees which mode each call used.
+	n, err := Scalar[int](WithQueryMode(ctx, pgx.QueryExecModeSimpleProtocol), p, "SELECT $1::int", 7)
+	if err != nil || n != 7 {
+		t.Fatalf("Scalar in simple protocol mode = %d, %v, want 7", n, err)
+	}
+	_, _ = Scalar[int](ctx, p, "SELECT $1::int", 7)
+	if got, want := drainQueries(server), []string{"SELECT  '7' ::int", "SELECT $1::int"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q: only the call given the mode uses it", got, want)
+	}
+}
+
+func TestSelectByPos(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	// The field names match no column, so only positional mapping fills them.
+	type line struct {
+		Number int64
+		Label  string
+	}
+	columns := []fakeColumn{{name: "id", oid: pgtype.Int8OID}, {name: "note", oid: pgtype.TextOID}}
+	server.answer("SELECT id, note FROM lines", columns, []any{int64(1), "a"}, []any{int64(2), "b"})
+	server.answer("SELECT id, note FROM lines WHERE false", columns)
+	lines, err := SelectByPos[line](ctx, p, "SELECT id, note FROM lines")
+	if want := []line{{1, "a"}, {2, "b"}}; err != nil || !reflect.DeepEqual(lines, want) {
+		t.Errorf("SelectByPos = %v, %v, want %v", lines, err, want)
+	}
+	if _, err := Select[line](ctx, p, "SELECT id, note FROM lines"); err == nil {
+		t.Error("Select mapped the columns by name to fields of other names")
+	}
+	first, err := GetByPos[line](ctx, p, "SELECT id, note FROM lines")
+	if err != nil || first != (line{1, "a"}) {
+		t.Errorf("GetByPos = %v, %v, want the first row", first, err)
+	}
+	if _, err := GetByPos[line](ctx, p, "SELECT id, note FROM lines WHERE false"); !errors.Is(err, ErrNoRows) {
+		t.Errorf("GetByPos without rows = %v, want ErrNoRows", err)
+	}
+	if _, err := SelectByPos[struct{ Number int64 }](ctx, p, "SELECT id, note FROM lines"); err == nil {
+		t.Error("SelectByPos into a struct with fewer fields than columns succeeded")
+	}
+}
+
+func TestGetOr(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	columns := []fakeColumn{{name: "id", oid: pgtype.Int8OID}, {name: "customerName", oid: pgtype.TextOID}}
+	server.answer("SELECT id, customerName FROM orders", columns, []any{int64(1), "ann"})
+	server.answer("SELECT id, customerName FROM orders WHERE false", columns)
+	errOrderNotFound := errors.New("order not found")
+	order, err := GetOr[testOrder](ctx, p, errOrderNotFound, "SELECT id, customerName FROM orders")
+	if err != nil || order != (testOrder{ID: 1, Customer: "ann"}) {
+		t.Errorf("GetOr = %+v, %v, want the row", order, err)
+	}
+	if _, err := GetOr[testOrder](ctx, p, errOrderNotFound, "SELECT id, customerName FROM orders WHERE false"); err != errOrderNotFound {
+		t.Errorf("GetOr without rows = %v, want the not found error", err)
+	}
+	// The fake server refuses to prepare statements it has no result for.
+	_, err = GetOr[testOrder](ctx, p, errOrderNotFound, "SELECT * FROM missing")
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || errors.Is(err, errOrderNotFound) {
+		t.Errorf("GetOr on a failing query = %v, want the server error unchanged", err)
+	}
+}
+
+func TestScanArray(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	b := "b"
+	server.answer("SELECT ints", []fakeColumn{{name: "ints", oid: pgtype.Int4ArrayOID}}, []any{[]int32{3, 1, 2}})
+	server.answer("SELECT texts", []fakeColumn{{name: "texts", oid: pgtype.TextArrayOID}}, []any{[]*string{nil, &b}})
+	server.answer("SELECT null_texts", []fakeColumn{{name: "texts", oid: pgtype.TextArrayOID}}, []any{nil})
+	ints, err := ScanArray[int32](ctx, p, "SELECT ints")
+	if want := []int32{3, 1, 2}; err != nil || !reflect.DeepEqual(ints, want) {
+		t.Errorf("ScanArray of int4[] = %v, %v, want %v", ints, err, want)
+	}
+	texts, err := ScanArray[string](ctx, p, "SELECT texts")
+	if want := []string{"", "b"}; err != nil || !reflect.DeepEqual(texts, want) {
+		t.Errorf("ScanArray of text[] with a NULL = %q, %v, want %q", texts, err, want)
+	}
+	if texts, err := ScanArray[string](ctx, p, "SELECT null_texts"); err != nil || texts != nil {
+		t.Errorf("ScanArray of a NULL array = %q, %v, want nil", texts, err)
+	}
+}
+
+func TestSelectMap(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	columns := []fakeColumn{{name: "id", oid: pgtype.Int8OID}, {name: "customerName", oid: pgtype.TextOID}}
+	server.answer("SELECT id, customerName FROM orders", columns,
+		[]any{int64(1), "ann"}, []any{int64(2), "bob"}, []any{int64(3), "ann"})
+	server.answer("SELECT id, customerName FROM orders WHERE false", columns)
+	byID, err := SelectMap(ctx, p, func(o testOrder) int64 { return o.ID }, "SELECT id, customerName FROM orders")
+	if want := map[int64]testOrder{1: {1, "ann"}, 2: {2, "bob"}, 3: {3, "ann"}}; err != nil || !reflect.DeepEqual(byID, want) {
+		t.Errorf("SelectMap by id = %v, %v, want %v", byID, err, want)
+	}
+	byCustomer, err := SelectMap(ctx, p, func(o testOrder) string { return o.Customer }, "SELECT id, customerName FROM orders")
+	if want := map[string]testOrder{"ann": {3, "ann"}, "bob": {2, "bob"}}; err != nil || !reflect.DeepEqual(byCustomer, want) {
+		t.Errorf("SelectMap by customer = %v, %v, want %v with the last duplicate", byCustomer, err, want)
+	}
+	empty, err := SelectMap(ctx, p, func(o testOrder) int64 { return o.ID }, "SELECT id, customerName FROM orders WHERE false")
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("SelectMap without rows = %v, %v, want an empty map", empty, err)
+	}
+	if _, err := SelectMap(ctx, p, func(o testOrder) int64 { return o.ID }, "SELECT * FROM missing"); err == nil {
+		t.Error("SelectMap of a failing query succeeded")
+	}
+}
+
+func TestCount(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	count := []fakeColumn{{name: "count", oid: pgtype.Int8OID}}
+	server.answer(`SELECT count(*) FROM "sales"."orders"`, count, []any{int64(3)})
+	server.answer(`SELECT count(*) FROM "sales"."orders" WHERE status = 'open'`, count, []any{int64(2)})
+	server.answer(`SELECT count(*) FROM (SELECT id FROM orders ORDER BY id) AS q`, count, []any{int64(3)})
+	for _, tt := range []struct {
+		where string
+		want  int64
+	}{{"", 3}, {"  ", 3}, {" status = 'open' ", 2}} {
+		if n, err := Count(ctx, p, "sales.orders", tt.where); err != nil || n != tt.want {
+			t.Errorf("Count where %q = %d, %v, want %d", tt.where, n, err, tt.want)
+		}
+	}
+	if n, err := CountQuery(ctx, p, "SELECT id FROM orders ORDER BY id"); err != nil || n != 3 {
+		t.Errorf("CountQuery = %d, %v, want 3", n, err)
+	}
+	q := &recordingQuerier{}
+	_, _ = Count(ctx, q, "orders", "status = $1", "open")
+	if sql, args := q.last(t); sql != `SELECT count(*) FROM "orders" WHERE status = $1` || !reflect.DeepEqual(args, []any{"open"}) {
+		t.Errorf("Count sent %s %v", sql, args)
+	}
+	if _, err := Count(ctx, q, "a.b.c", ""); err == nil {
+		t.Error("Count of a three part name succeeded")
+	}
+}
+
+func TestQueryEachStopsEarly(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server, WithMaxConns(1))
+	ctx := testContext(t)
+	rows := make([][]any, 100)
+	for i := range rows {
+		rows[i] = []any{int64(i)}
+	}
+	server.answer("SELECT n FROM numbers", []fakeColumn{{name: "n", oid: pgtype.Int8OID}}, rows...)
+	errStop := errors.New("stop")
+	var seen []int64
+	err := QueryEach(ctx, p, "SELECT n FROM numbers", nil, func(row pgx.Row) error {
+		var n int64
+		if err := row.Scan(&n); err != nil {
+			return err
+		}
+		seen = append(seen, n)
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || !reflect.DeepEqual(seen, []int64{0, 1, 2}) {
+		t.Errorf("QueryEach = %v after rows %v, want the callback's error after rows 0 to 2", err, seen)
+	}
+	if acquired := p.Stat().AcquiredConns(); acquired != 0 {
+		t.Errorf("%d connections acquired after QueryEach returned, want 0", acquired)
+	}
+	// The pool's only connection was released with the rest of the result discarded, so it serves the next query.
+	var total int
+	err = QueryEach(ctx, p, "SELECT n FROM numbers", nil, func(pgx.Row) error {
+		total++
+		return nil
+	})
+	if err != nil || total != 100 {
+		t.Errorf("QueryEach after stopping early = %v with %d rows, want all 100", err, total)
+	}
+}
+
+func TestSelectWithTag(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	columns := []fakeColumn{{name: "id", oid: pgtype.Int8OID}, {name: "customerName", oid: pgtype.TextOID}}
+	server.answer("SELECT id, customerName FROM orders", columns, []any{int64(1), "ann"}, []any{int64(2), "bob"})
+	orders, tag, err := SelectWithTag[testOrder](ctx, p, "SELECT id, customerName FROM orders")
+	if want := []testOrder{{1, "ann"}, {2, "bob"}}; err != nil || !reflect.DeepEqual(orders, want) {
+		t.Errorf("SelectWithTag = %v, %v, want %v", orders, err, want)
+	}
+	if !tag.Select() || tag.RowsAffected() != 2 {
+		t.Errorf("SelectWithTag tag = %q, want SELECT 2", tag)
+	}
+	if _, tag, err := SelectWithTag[testOrder](ctx, p, "SELECT * FROM missing"); err == nil || tag.String() != "" {
+		t.Errorf("SelectWithTag of a failing query = %q, %v, want an empty tag and the error", tag, err)
+	}
+}
+
+func TestSelectWithTagUpdate(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testTable(t, "select_with_tag", `id int8, "customerName" text`)
+	if _, err := p.Exec(ctx, `INSERT INTO `+table+` VALUES (1, 'ann'), (2, 'bob'), (3, 'eve')`); err != nil {
+		t.Fatal(err)
+	}
+	orders, tag, err := SelectWithTag[testOrder](ctx, p,
+		`UPDATE `+table+` SET "customerName" = upper("customerName") WHERE id < 3 RETURNING id, "customerName"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	if want := []testOrder{{1, "ANN"}, {2, "BOB"}}; !reflect.DeepEqual(orders, want) {
+		t.Errorf("SelectWithTag returned %v, want %v", orders, want)
+	}
+	if !tag.Update() || tag.RowsAffected() != 2 {
+		t.Errorf("SelectWithTag tag = %q, want UPDATE 2", tag)
+	}
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// applyHooks chains the connection hooks registered by the options into the pool config, in the order the options were passed.
+func applyHooks(cfg *pgxpool.Config, opt *options) {
+	if hooks := opt.beforeconnect; len(hooks) > 0 {
+		cfg.BeforeConnect = func(ctx context.Context, config *pgx.ConnConfig) error {
+			for _, hook := range hooks {
+				if err := hook(ctx, config); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if hooks := opt.validateconnect; len(hooks) > 0 {
+		if previous := cfg.ConnConfig.ValidateConnect; previous != nil {
+			hooks = append([]pgconn.ValidateConnectFunc{previous}, hooks...)
+		}
+		cfg.ConnConfig.ValidateConnect = func(ctx context.Context, conn *pgconn.PgConn) error {
+			for _, hook := range hooks {
+				if err := hook(ctx, conn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if hooks := opt.afterconnect; len(hooks) > 0 {
+		cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			for _, hook := range hooks {
+				if err := hook(ctx, conn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if hooks := opt.beforeacquire; len(hooks) > 0 {
+		cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+			for _, hook := range hooks {
+				if !hook(ctx, conn) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if hooks := opt.afterrelease; len(hooks) > 0 {
+		cfg.AfterRelease = func(conn *pgx.Conn) bool {
+			for _, hook := range hooks {
+				if !hook(conn) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if hooks := opt.beforeclose; len(hooks) > 0 {
+		cfg.BeforeClose = func(conn *pgx.Conn) {
+			for _, hook := range hooks {
+				hook(conn)
+			}
+		}
+	}
+}
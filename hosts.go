@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Hosts sets the servers to connect to, each "host" or "host:port"; hosts without a port use WithPort or the default.
+// They are tried in the given order until one accepts the connection, so list the preferred server first. Overrides WithHost.
+// IPv6 addresses can only be used as the single host, since a connection URL cannot list them with others.
+func WithHosts(hosts ...string) Option {
+	return func(options *options) error {
+		if len(hosts) == 0 {
+			return fmt.Errorf("hosts cannot be empty")
+		}
+		for _, host := range hosts {
+			if strings.TrimSpace(host) == "" {
+				return fmt.Errorf("host cannot be empty")
+			}
+			if len(hosts) > 1 && strings.Count(host, ":") > 1 {
+				return fmt.Errorf("IPv6 host %q cannot be listed with other hosts", host)
+			}
+			if _, port, err := net.SplitHostPort(host); err == nil {
+				if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+					return fmt.Errorf("invalid port in host %q", host)
+				}
+			}
+		}
+		options.hosts = hosts
+		return nil
+	}
+}
+
+// HostOrder chooses how the hosts of WithHosts are tried. With strict they are always tried in the given sequence; without it
+// every new connection tries them in a random order, spreading connections over the hosts. default strict
+func WithHostOrder(strict bool) Option {
+	return func(options *options) error {
+		if !strict {
+			options.beforeconnect = append(options.beforeconnect, shuffleHosts)
+		}
+		return nil
+	}
+}
+
+// hostList returns the hosts of WithHosts as the host part of a connection URL. Hosts without a port are given port, unless it is 0.
+func hostList(hosts []string, port int) string {
+	list := make([]string, len(hosts))
+	for i, host := range hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil && port != 0 {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+		}
+		list[i] = host
+	}
+	return strings.Join(list, ",")
+}
+
+// shuffleHosts randomizes the order in which the hosts of config are tried, keeping the attempts for one host, e.g. with and
+// without TLS, together and in order. config is a copy made for one connection attempt.
+func shuffleHosts(_ context.Context, config *pgx.ConnConfig) error {
+	all := append([]*pgconn.FallbackConfig{{Host: config.Host, Port: config.Port, TLSConfig: config.TLSConfig}}, config.Fallbacks...)
+	var groups [][]*pgconn.FallbackConfig
+	for i, fallback := range all {
+		if i > 0 && fallback.Host == all[i-1].Host && fallback.Port == all[i-1].Port {
+			groups[len(groups)-1] = append(groups[len(groups)-1], fallback)
+			continue
+		}
+		groups = append(groups, []*pgconn.FallbackConfig{fallback})
+	}
+	rand.Shuffle(len(groups), func(i, j int) { groups[i], groups[j] = groups[j], groups[i] })
+	all = all[:0]
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+	config.Host, config.Port, config.TLSConfig = all[0].Host, all[0].Port, all[0].TLSConfig
+	config.Fallbacks = all[1:]
+	return nil
+}
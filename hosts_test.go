@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestHostList(t *testing.T) {
+	tests := []struct {
+		hosts []string
+		port  int
+		want  string
+	}{
+		{[]string{"a", "b:5433", "c"}, 5432, "a:5432,b:5433,c:5432"},
+		{[]string{"a", "b"}, 0, "a,b"},
+		{[]string{"::1"}, 5432, "[::1]:5432"},
+		{[]string{"[::1]:6432"}, 5432, "[::1]:6432"},
+	}
+	for _, tt := range tests {
+		if got := hostList(tt.hosts, tt.port); got != tt.want {
+			t.Errorf("hostList(%v, %d) = %s, want %s", tt.hosts, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestHostsValidate(t *testing.T) {
+	for _, hosts := range [][]string{nil, {""}, {"a", " "}, {"a", "::1"}, {"a:port"}, {"a:70000"}} {
+		if err := WithHosts(hosts...)(&options{}); err == nil {
+			t.Errorf("WithHosts accepted %q", hosts)
+		}
+	}
+}
+
+func TestHostsTriedInOrder(t *testing.T) {
+	startups := make(chan startup, 16)
+	var servers []*fakeServer
+	var hosts []string
+	for i := 0; i < 3; i++ {
+		server := listenFake(t, "53300", startups)
+		servers = append(servers, server)
+		hosts = append(hosts, fmt.Sprintf("127.0.0.1:%d", server.port))
+	}
+	if _, err := New(context.Background(), WithHosts(hosts...), WithSSLMode("disable")); err == nil {
+		t.Fatal("New succeeded against servers rejecting every login")
+	}
+	for i, server := range servers {
+		if got := (<-startups).port; got != server.port {
+			t.Fatalf("login %d went to port %d, want %d, the host listed at that position", i+1, got, server.port)
+		}
+	}
+}
+
+func TestShuffleHostsKeepsAttemptsTogether(t *testing.T) {
+	tlsConfig := &tls.Config{}
+	build := func() *pgx.ConnConfig {
+		config := &pgx.ConnConfig{}
+		config.Host, config.Port, config.TLSConfig = "a", 1, tlsConfig
+		config.Fallbacks = []*pgconn.FallbackConfig{{Host: "a", Port: 1}, {Host: "b", Port: 2, TLSConfig: tlsConfig}, {Host: "b", Port: 2}, {Host: "c", Port: 3}}
+		return config
+	}
+	firsts := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		config := build()
+		if err := shuffleHosts(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+		all := append([]*pgconn.FallbackConfig{{Host: config.Host, Port: config.Port, TLSConfig: config.TLSConfig}}, config.Fallbacks...)
+		var order []string
+		for j, attempt := range all {
+			order = append(order, attempt.Host)
+			if attempt.Host != "c" && (attempt.TLSConfig != nil) != (j == 0 || all[j-1].Host != attempt.Host) {
+				t.Fatalf("shuffleHosts reordered the TLS and plain attempts for %s", attempt.Host)
+			}
+		}
+		firsts[config.Host] = true
+		counts := map[string]int{}
+		for j, host := range order {
+			counts[host]++
+			if j > 0 && host != order[j-1] && counts[host] > 1 {
+				t.Fatalf("shuffleHosts split the attempts for %s: %v", host, order)
+			}
+		}
+		if counts["a"] != 2 || counts["b"] != 2 || counts["c"] != 1 {
+			t.Fatalf("shuffleHosts changed the attempts: %v", order)
+		}
+	}
+	if len(firsts) != 3 {
+		t.Errorf("shuffleHosts put only %v first in 200 runs, want every host", firsts)
+	}
+}
+
+func TestConnectTimeoutPerHost(t *testing.T) {
+	silent := silentServer(t)
+	server := newRejectingServer(t, "53300")
+	start := time.Now()
+	_, err := New(context.Background(), WithHosts(fmt.Sprintf("127.0.0.1:%d", silent), fmt.Sprintf("127.0.0.1:%d", server.port)),
+		WithSSLMode("disable"), WithConnectTimeout(200*time.Millisecond))
+	elapsed := time.Since(start)
+	if !IsTooManyConnections(err) {
+		t.Fatalf("New error = %v, want the second host's rejection after the first timed out", err)
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("New took %s, want about the 200ms timeout of the silent first host", elapsed)
+	}
+	if msg := err.Error(); !strings.Contains(msg, strconv.Itoa(silent)) || !strings.Contains(msg, "timeout") {
+		t.Errorf("New error = %q, want it to report the timeout of the first host", msg)
+	}
+	if err := WithConnectTimeout(-time.Second)(&options{}); err == nil {
+		t.Error("WithConnectTimeout accepted a negative timeout")
+	}
+}
+
+func TestConnectTimeoutFallsThrough(t *testing.T) {
+	u := testURL(t)
+	silent := silentServer(t)
+	target := u.Host
+	if u.Port() == "" {
+		target += ":5432"
+	}
+	p, err := New(testContext(t), append(testOptions(t), WithHosts(fmt.Sprintf("127.0.0.1:%d", silent), target),
+		WithConnectTimeout(200*time.Millisecond))...)
+	if err != nil {
+		t.Fatalf("New with a silent first host: %v", err)
+	}
+	defer p.Close()
+	if _, err := Scalar[int](testContext(t), p, "SELECT 1"); err != nil {
+		t.Error(err)
+	}
+}
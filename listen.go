@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Notification is a NOTIFY delivered by Listen.
+type Notification struct {
+	Channel string
+	Payload string // payload of the last notification when several were coalesced
+	PID     int32  // backend process ID of the last notifying session
+	Count   int    // number of notifications coalesced into this one, 1 without WithNotifyCoalescing
+}
+
+// NotifyCoalescing makes Listen merge the notifications arriving within window of the first one into a single delivery carrying
+// the last payload and the count. Every notification is followed by a delivery that includes it, at most window later, but
+// individual payloads other than the last are lost. Meant for consumers that only need to know that something changed.
+func WithNotifyCoalescing(window time.Duration) Option {
+	return func(options *options) error {
+		if window <= 0 {
+			return fmt.Errorf("notify coalescing window must be greater than zero")
+		}
+		options.notifycoalescing = window
+		return nil
+	}
+}
+
+// Listen holds a connection listening on channel and calls handler for every notification, one at a time, until ctx is done or
+// the connection fails. It then returns ctx.Err() or the connection error; notifications sent while no Listen is running are lost.
+// A slow handler delays reading further notifications, which the server queues meanwhile.
+func (p *Pool) Listen(ctx context.Context, channel string, handler func(n Notification)) error {
+	quoted, err := quoteIdent(channel)
+	if err != nil {
+		return err
+	}
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "LISTEN "+quoted); err != nil {
+		return fmt.Errorf("listen %s: %w", channel, err)
+	}
+	// The connection is closed by the driver when a wait for a notification is cancelled, so it is not reused after ctx is done.
+	if p.coalesce <= 0 {
+		for {
+			n, err := conn.Conn().WaitForNotification(ctx)
+			if err != nil {
+				return listenError(ctx, err)
+			}
+			handler(Notification{Channel: n.Channel, Payload: n.Payload, PID: int32(n.PID), Count: 1})
+		}
+	}
+	received := make(chan Notification)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			n, err := conn.Conn().WaitForNotification(ctx)
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case received <- Notification{Channel: n.Channel, Payload: n.Payload, PID: int32(n.PID), Count: 1}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return coalesce(ctx, received, failed, p.coalesce, handler)
+}
+
+// coalesce merges the notifications arriving on received within window of the first one into one call of handler, until an
+// error arrives on failed, which it returns after delivering what is pending.
+func coalesce(ctx context.Context, received <-chan Notification, failed <-chan error, window time.Duration, handler func(n Notification)) error {
+	var pending *Notification
+	flush := time.NewTimer(window)
+	flush.Stop()
+	defer flush.Stop()
+	for {
+		select {
+		case n := <-received:
+			if pending == nil {
+				pending = &n
+				flush.Reset(window)
+				continue
+			}
+			pending.Payload, pending.PID = n.Payload, n.PID
+			pending.Count++
+		case <-flush.C:
+			handler(*pending)
+			pending = nil
+		case err := <-failed:
+			if pending != nil {
+				handler(*pending)
+			}
+			return listenError(ctx, err)
+		}
+	}
+}
+
+func listenError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("wait for notification: %w", err)
+}
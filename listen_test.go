@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCoalesceBurst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan Notification)
+	failed := make(chan error, 1)
+	delivered := make(chan Notification, 8)
+	done := make(chan error, 1)
+	go func() {
+		done <- coalesce(ctx, received, failed, 50*time.Millisecond, func(n Notification) { delivered <- n })
+	}()
+	for i := 1; i <= 5; i++ {
+		received <- Notification{Channel: "jobs", Payload: strconv.Itoa(i), PID: int32(i), Count: 1}
+	}
+	select {
+	case n := <-delivered:
+		if n.Channel != "jobs" || n.Payload != "5" || n.PID != 5 || n.Count != 5 {
+			t.Errorf("delivery = %+v, want the last payload and a count of 5", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no delivery within a second of the burst")
+	}
+	select {
+	case n := <-delivered:
+		t.Errorf("second delivery %+v for a single burst", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// What is pending when the connection fails is still delivered, and the context error is returned.
+	received <- Notification{Channel: "jobs", Payload: "6", Count: 1}
+	cancel()
+	failed <- errors.New("conn closed")
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("coalesce = %v, want context.Canceled", err)
+	}
+	if n := <-delivered; n.Payload != "6" || n.Count != 1 {
+		t.Errorf("delivery on failure = %+v, want the pending notification", n)
+	}
+}
+
+func TestNotifyCoalescingValidate(t *testing.T) {
+	for _, window := range []time.Duration{0, -time.Second} {
+		if err := WithNotifyCoalescing(window)(&options{}); err == nil {
+			t.Errorf("WithNotifyCoalescing accepted %s", window)
+		}
+	}
+}
+
+func TestListenCoalescesBurst(t *testing.T) {
+	p := testPool(t, WithNotifyCoalescing(200*time.Millisecond))
+	ctx, cancel := context.WithCancel(testContext(t))
+	defer cancel()
+	channel := testName("test_listen")
+	delivered := make(chan Notification, 8)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Listen(ctx, channel, func(n Notification) { delivered <- n })
+	}()
+	// Wait for LISTEN to be in place by sending until something arrives, then burst.
+	for len(delivered) == 0 {
+		if _, err := p.Exec(ctx, "SELECT pg_notify($1, 'probe')", channel); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+	for len(delivered) > 0 {
+		<-delivered
+	}
+	if err := p.WithTx(ctx, func(tx *Tx) error {
+		for i := 1; i <= 5; i++ {
+			if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", channel, strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	n := <-delivered
+	if n.Payload != "5" || n.Count != 5 {
+		t.Errorf("delivery = %+v, want one carrying the last payload and a count of 5", n)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if len(delivered) != 0 {
+		t.Errorf("%d more deliveries for one burst", len(delivered))
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Listen = %v, want context.Canceled", err)
+	}
+}
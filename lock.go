@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// MigrateWithLock runs fn while holding the session-level advisory lock lockKey, so when several instances start at once only one runs
+// its migrations while the others wait for the lock. The lock is released when fn returns; if releasing fails the connection is closed,
+// which releases the lock on the server.
+func MigrateWithLock(ctx context.Context, p *Pool, lockKey int64, fn func() error) (err error) {
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire advisory lock %d: %w", lockKey, err)
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reset_timeout)
+		defer cancel()
+		if _, unlockErr := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", lockKey); unlockErr != nil {
+			conn.Conn().Close(unlockCtx)
+			if err == nil {
+				err = fmt.Errorf("release advisory lock %d: %w", lockKey, unlockErr)
+			}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMigrateWithLockExcludes(t *testing.T) {
+	p := testPool(t, WithMaxConns(4))
+	ctx := testContext(t)
+	key := time.Now().UnixNano()
+	var inside, overlaps, runs atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := MigrateWithLock(ctx, p, key, func() error {
+				if inside.Add(1) > 1 {
+					overlaps.Add(1)
+				}
+				runs.Add(1)
+				time.Sleep(200 * time.Millisecond)
+				inside.Add(-1)
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs.Load() != 2 || overlaps.Load() != 0 {
+		t.Errorf("%d runs with %d overlapping, want both to run one after the other", runs.Load(), overlaps.Load())
+	}
+	// The lock is released after an error too, so the next caller does not wait.
+	errMigration := errors.New("migration failed")
+	if err := MigrateWithLock(ctx, p, key, func() error { return errMigration }); !errors.Is(err, errMigration) {
+		t.Errorf("MigrateWithLock = %v, want the migration error", err)
+	}
+	held, err := Exists(ctx, p, "SELECT EXISTS(SELECT 1 FROM pg_locks WHERE locktype = 'advisory' AND ((classid::bigint << 32) | objid::bigint) = $1)", key)
+	if err != nil || held {
+		t.Errorf("advisory lock held after MigrateWithLock returned: %v, %v", held, err)
+	}
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Manager lazily creates and caches one pool per database, all sharing the same options. It is safe for concurrent use.
+type Manager struct {
+	opts []Option
+
+	mu      sync.Mutex
+	pools   map[string]*Pool
+	pending map[string]*managedPool
+	closed  bool
+}
+
+type managedPool struct {
+	done      chan struct{}
+	pool      *Pool
+	err       error
+	cancelled bool // New failed because the context of the call that made it was done
+}
+
+// NewManager returns a Manager whose pools are created with opts. The database is set by Manager.Pool, overriding any WithDatabase in opts.
+func NewManager(opts ...Option) *Manager {
+	return &Manager{
+		opts:    opts,
+		pools:   make(map[string]*Pool),
+		pending: make(map[string]*managedPool),
+	}
+}
+
+// Pool returns the pool for database, creating it with New on first use. Concurrent calls for the same database share one New call.
+// A failed New is not cached, so the next call tries again. A call waiting for a New that failed only because the context of
+// the call making it was done makes its own.
+func (m *Manager) Pool(ctx context.Context, database string) (*Pool, error) {
+	if database == "" {
+		return nil, fmt.Errorf("database cannot be empty")
+	}
+	for {
+		pool, retry, err := m.pool(ctx, database)
+		if !retry {
+			return pool, err
+		}
+	}
+}
+
+// pool makes one attempt of Pool, reporting retry when it waited for a New cut short by another caller's context.
+func (m *Manager) pool(ctx context.Context, database string) (*Pool, bool, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, false, fmt.Errorf("manager is closed")
+	}
+	if pool, ok := m.pools[database]; ok {
+		m.mu.Unlock()
+		return pool, false, nil
+	}
+	if pending, ok := m.pending[database]; ok {
+		m.mu.Unlock()
+		select {
+		case <-pending.done:
+			return pending.pool, pending.cancelled && ctx.Err() == nil, pending.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	pending := &managedPool{done: make(chan struct{})}
+	m.pending[database] = pending
+	m.mu.Unlock()
+
+	pool, err := New(ctx, append(m.opts[:len(m.opts):len(m.opts)], WithDatabase(database))...)
+
+	m.mu.Lock()
+	delete(m.pending, database)
+	if err == nil {
+		if m.closed {
+			pool.Close()
+			pool, err = nil, fmt.Errorf("manager is closed")
+		} else {
+			m.pools[database] = pool
+		}
+	}
+	m.mu.Unlock()
+	pending.pool, pending.err, pending.cancelled = pool, err, err != nil && ctx.Err() != nil
+	close(pending.done)
+	return pool, false, err
+}
+
+// Close closes all pools created by the manager. Pool fails after Close.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	pools := m.pools
+	m.pools = make(map[string]*Pool)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, pool := range pools {
+		wg.Add(1)
+		go func(pool *Pool) {
+			defer wg.Done()
+			pool.Close()
+		}(pool)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerCachesPools(t *testing.T) {
+	server := newAcceptingServer(t)
+	m := NewManager(WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithDatabase("ignored"))
+	ctx := context.Background()
+	if _, err := m.Pool(ctx, ""); err == nil {
+		t.Error("Pool accepted an empty database")
+	}
+	const callers = 8
+	pools := make([]*Pool, callers)
+	var wg sync.WaitGroup
+	for i := range pools {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if pools[i], err = m.Pool(ctx, "orders"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, p := range pools[1:] {
+		if p != pools[0] {
+			t.Fatal("concurrent calls for the same database returned different pools")
+		}
+	}
+	if again, err := m.Pool(ctx, "orders"); err != nil || again != pools[0] {
+		t.Errorf("second Pool(orders) = %p, %v, want the cached %p", again, err, pools[0])
+	}
+	billing, err := m.Pool(ctx, "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if billing == pools[0] {
+		t.Error("Pool(billing) returned the pool of orders")
+	}
+	databases := map[string]int{}
+	for len(server.startups) > 0 {
+		databases[(<-server.startups).params["database"]]++
+	}
+	if len(databases) != 2 || databases["orders"] != 1 || databases["billing"] != 1 {
+		t.Errorf("connections per database = %v, want one startup ping each for orders and billing", databases)
+	}
+
+	m.Close()
+	for _, p := range []*Pool{pools[0], billing} {
+		if err := p.Ping(ctx); err == nil {
+			t.Error("a pool of the manager still works after Close")
+		}
+	}
+	if _, err := m.Pool(ctx, "orders"); err == nil {
+		t.Error("Pool succeeded after Close")
+	}
+}
+
+func TestManagerRetriesFailedNew(t *testing.T) {
+	server := newRejectingServer(t, "53300")
+	m := NewManager(WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"))
+	defer m.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := m.Pool(context.Background(), "orders"); !IsTooManyConnections(err) {
+			t.Fatalf("Pool = %v, want the server's rejection", err)
+		}
+	}
+	if n := len(server.startups); n != 2 {
+		t.Errorf("%d logins for two calls, want the failed New not cached", n)
+	}
+}
+
+func TestManagerWaiterOutlivesCancelledNew(t *testing.T) {
+	m := NewManager(WithHost("127.0.0.1"), WithPort(silentServer(t)), WithSSLMode("disable"))
+	defer m.Close()
+	creatorCtx, cancel := context.WithCancel(context.Background())
+	creator := make(chan error, 1)
+	go func() {
+		_, err := m.Pool(creatorCtx, "orders")
+		creator <- err
+	}()
+	for pending := 0; pending == 0; time.Sleep(time.Millisecond) {
+		m.mu.Lock()
+		pending = len(m.pending)
+		m.mu.Unlock()
+	}
+	waiterCtx, cancelWaiter := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelWaiter()
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := m.Pool(waiterCtx, "orders")
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let the waiter find the pending New
+	cancel()
+	if err := <-creator; !errors.Is(err, context.Canceled) {
+		t.Errorf("Pool of the cancelled caller = %v, want context.Canceled", err)
+	}
+	// the waiter makes its own New, which the silent server lets run until the waiter's deadline
+	if err := <-waiter; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Pool of the waiting caller = %v, want its own deadline rather than the other caller's cancellation", err)
+	}
+}
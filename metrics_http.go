@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MetricsHandler returns an http.Handler serving the statistics of pool in the Prometheus text exposition format, for services
+// that want a /metrics endpoint without the Prometheus client library. Metric names are prefixed with namespace and "_pool_",
+// e.g. "myapp_pool_acquired_conns", or just "pool_" with an empty namespace. The pool name set with WithName is the "pool" label.
+func MetricsHandler(pool *Pool, namespace string) http.Handler {
+	prefix := "pool_"
+	if namespace != "" {
+		prefix = namespace + "_" + prefix
+	}
+	labels := ""
+	if pool.name != "" {
+		labels = `{pool="` + escapeLabel(pool.name) + `"}`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		stat := pool.Stat()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		var b strings.Builder
+		metric := func(name, typ, help string, value any) {
+			fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n%s%s%s %v\n", prefix, name, help, prefix, name, typ, prefix, name, labels, value)
+		}
+		metric("acquired_conns", "gauge", "Number of currently acquired connections.", stat.AcquiredConns())
+		metric("idle_conns", "gauge", "Number of currently idle connections.", stat.IdleConns())
+		metric("constructing_conns", "gauge", "Number of connections being established.", stat.ConstructingConns())
+		metric("total_conns", "gauge", "Total number of connections in the pool.", stat.TotalConns())
+		metric("max_conns", "gauge", "Maximum size of the pool.", stat.MaxConns())
+		metric("acquire_count_total", "counter", "Cumulative count of successful acquires.", stat.AcquireCount())
+		metric("acquire_duration_seconds_total", "counter", "Total time spent acquiring connections.", stat.AcquireDuration().Seconds())
+		metric("empty_acquire_count_total", "counter", "Cumulative count of acquires that waited for a connection.", stat.EmptyAcquireCount())
+		metric("canceled_acquire_count_total", "counter", "Cumulative count of acquires canceled by their context.", stat.CanceledAcquireCount())
+		metric("new_conns_count_total", "counter", "Cumulative count of new connections opened.", stat.NewConnsCount())
+		metric("max_lifetime_destroy_count_total", "counter", "Cumulative count of connections closed for exceeding their max lifetime.", stat.MaxLifetimeDestroyCount())
+		metric("max_idle_destroy_count_total", "counter", "Cumulative count of connections closed for exceeding their max idle time.", stat.MaxIdleDestroyCount())
+		fmt.Fprint(w, b.String())
+	})
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
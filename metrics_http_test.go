@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics parses the exposition recorded in rec and returns its samples by metric name and labels, e.g. `x_total{pool="a"}`.
+func scrapeMetrics(t *testing.T, rec *httptest.ResponseRecorder) map[string]float64 {
+	t.Helper()
+	samples := map[string]float64{}
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("malformed sample %q", line)
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("malformed value in %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetricsHandler(t *testing.T) {
+	p := unreachablePool(t, &logRecorder{})
+	p.name = `orders "eu"`
+	rec := httptest.NewRecorder()
+	MetricsHandler(p, "myapp").ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"# TYPE myapp_pool_max_conns gauge\n", "# TYPE myapp_pool_acquire_count_total counter\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("exposition lacks %q:\n%s", want, body)
+		}
+	}
+	samples := scrapeMetrics(t, rec)
+	if len(samples) != 12 {
+		t.Errorf("scraped %d samples, want 12:\n%s", len(samples), body)
+	}
+	label := `{pool="orders \"eu\""}`
+	if got, ok := samples["myapp_pool_max_conns"+label]; !ok || got != float64(p.Config().MaxConns) {
+		t.Errorf("myapp_pool_max_conns%s = %v, %v, want %d", label, got, ok, p.Config().MaxConns)
+	}
+	if got, ok := samples["myapp_pool_total_conns"+label]; !ok || got != 0 {
+		t.Errorf("myapp_pool_total_conns%s = %v, %v, want 0", label, got, ok)
+	}
+}
+
+func TestMetricsHandlerWithoutNamespaceOrName(t *testing.T) {
+	p := unreachablePool(t, &logRecorder{})
+	rec := httptest.NewRecorder()
+	MetricsHandler(p, "").ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if _, ok := scrapeMetrics(t, rec)["pool_idle_conns"]; !ok {
+		t.Errorf("exposition lacks an unlabelled pool_idle_conns:\n%s", rec.Body.String())
+	}
+}
+
+func TestMetricsHandlerCountsAcquires(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	if _, err := Scalar[int](ctx, p, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	MetricsHandler(p, "").ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := scrapeMetrics(t, rec)["pool_acquire_count_total"]; got < 1 {
+		t.Errorf("pool_acquire_count_total = %v after a query, want at least 1", got)
+	}
+}
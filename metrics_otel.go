@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Registers observable OpenTelemetry instruments reporting pool.Stat(). The pool name set with WithName is added as the "pool" attribute.
+// The instruments are unregistered on Close.
+func WithOTelMetrics(meter metric.Meter) Option {
+	return func(options *options) error {
+		if meter == nil {
+			return fmt.Errorf("otel meter cannot be nil")
+		}
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			return registerOTelMetrics(p, meter)
+		})
+		return nil
+	}
+}
+
+func registerOTelMetrics(p *Pool, meter metric.Meter) error {
+	prefix := self_name + ".pool."
+	acquired, err := meter.Int64ObservableGauge(prefix+"acquired_conns", metric.WithDescription("Number of currently acquired connections."))
+	if err != nil {
+		return err
+	}
+	idle, err := meter.Int64ObservableGauge(prefix+"idle_conns", metric.WithDescription("Number of currently idle connections."))
+	if err != nil {
+		return err
+	}
+	total, err := meter.Int64ObservableGauge(prefix+"total_conns", metric.WithDescription("Total number of connections in the pool."))
+	if err != nil {
+		return err
+	}
+	maxConns, err := meter.Int64ObservableGauge(prefix+"max_conns", metric.WithDescription("Maximum size of the pool."))
+	if err != nil {
+		return err
+	}
+	acquires, err := meter.Int64ObservableCounter(prefix+"acquire_count", metric.WithDescription("Cumulative count of successful acquires."))
+	if err != nil {
+		return err
+	}
+	acquireDuration, err := meter.Float64ObservableCounter(prefix+"acquire_duration", metric.WithDescription("Total time spent acquiring connections."), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+
+	attrs := metric.WithAttributes()
+	if p.name != "" {
+		attrs = metric.WithAttributes(attribute.String("pool", p.name))
+	}
+	registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stat := p.Stat()
+		o.ObserveInt64(acquired, int64(stat.AcquiredConns()), attrs)
+		o.ObserveInt64(idle, int64(stat.IdleConns()), attrs)
+		o.ObserveInt64(total, int64(stat.TotalConns()), attrs)
+		o.ObserveInt64(maxConns, int64(stat.MaxConns()), attrs)
+		o.ObserveInt64(acquires, stat.AcquireCount(), attrs)
+		o.ObserveFloat64(acquireDuration, stat.AcquireDuration().Seconds(), attrs)
+		return nil
+	}, acquired, idle, total, maxConns, acquires, acquireDuration)
+	if err != nil {
+		return err
+	}
+	p.onclose = append(p.onclose, func() {
+		_ = registration.Unregister()
+	})
+	return nil
+}
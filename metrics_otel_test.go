@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// recordingMeter is a metric.Meter keeping the callback registered with it, whose instruments carry their names.
+type recordingMeter struct {
+	noop.Meter
+	callback     metric.Callback
+	unregistered bool
+}
+
+type namedInt64Gauge struct {
+	noop.Int64ObservableGauge
+	name string
+}
+
+type namedInt64Counter struct {
+	noop.Int64ObservableCounter
+	name string
+}
+
+type namedFloat64Counter struct {
+	noop.Float64ObservableCounter
+	name string
+}
+
+func (m *recordingMeter) Int64ObservableGauge(name string, _ ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	return namedInt64Gauge{name: name}, nil
+}
+
+func (m *recordingMeter) Int64ObservableCounter(name string, _ ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	return namedInt64Counter{name: name}, nil
+}
+
+func (m *recordingMeter) Float64ObservableCounter(name string, _ ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	return namedFloat64Counter{name: name}, nil
+}
+
+func (m *recordingMeter) RegisterCallback(callback metric.Callback, _ ...metric.Observable) (metric.Registration, error) {
+	m.callback = callback
+	return &recordingRegistration{meter: m}, nil
+}
+
+type recordingRegistration struct {
+	embedded.Registration
+	meter *recordingMeter
+}
+
+func (r *recordingRegistration) Unregister() error {
+	r.meter.unregistered = true
+	return nil
+}
+
+// recordingObserver keeps the observed values by instrument name along with the attributes of the last observation.
+type recordingObserver struct {
+	embedded.Observer
+	values map[string]float64
+	attrs  attribute.Set
+}
+
+func (o *recordingObserver) observe(instrument metric.Observable, value float64, opts []metric.ObserveOption) {
+	var name string
+	switch i := instrument.(type) {
+	case namedInt64Gauge:
+		name = i.name
+	case namedInt64Counter:
+		name = i.name
+	case namedFloat64Counter:
+		name = i.name
+	}
+	o.values[name] = value
+	o.attrs = metric.NewObserveConfig(opts).Attributes()
+}
+
+func (o *recordingObserver) ObserveInt64(instrument metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	o.observe(instrument, float64(value), opts)
+}
+
+func (o *recordingObserver) ObserveFloat64(instrument metric.Float64Observable, value float64, opts ...metric.ObserveOption) {
+	o.observe(instrument, value, opts)
+}
+
+func TestOTelMetrics(t *testing.T) {
+	if err := WithOTelMetrics(nil)(&options{}); err == nil {
+		t.Error("WithOTelMetrics accepted a nil meter")
+	}
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	p.name = "orders"
+	meter := &recordingMeter{}
+	var opt options
+	if err := WithOTelMetrics(meter)(&opt); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.onnew[0](p); err != nil {
+		t.Fatal(err)
+	}
+	observer := &recordingObserver{values: map[string]float64{}}
+	if err := meter.callback(context.Background(), observer); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"acquired_conns", "idle_conns", "total_conns", "max_conns", "acquire_count", "acquire_duration"} {
+		if _, ok := observer.values[self_name+".pool."+name]; !ok {
+			t.Errorf("%s was not observed", name)
+		}
+	}
+	if got, want := observer.values[self_name+".pool.max_conns"], float64(p.Config().MaxConns); got != want {
+		t.Errorf("max_conns = %v, want %v", got, want)
+	}
+	if pool, _ := observer.attrs.Value("pool"); pool.AsString() != "orders" {
+		t.Errorf("pool attribute = %q, want orders", pool.AsString())
+	}
+	p.Close()
+	if !meter.unregistered {
+		t.Error("Close did not unregister the callback")
+	}
+}
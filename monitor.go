@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+const saturation_samples = 60
+
+// SaturationWarning samples the pool in the background and logs a warning when it was saturated, i.e. every connection up to MaxConns
+// was acquired, during at least threshold (0 < threshold <= 1) of the last window. It warns at most once per window. Stopped by Close.
+func WithSaturationWarning(window time.Duration, threshold float64) Option {
+	return func(options *options) error {
+		if window < saturation_samples*time.Millisecond {
+			return fmt.Errorf("saturation window cannot be less than %s", saturation_samples*time.Millisecond)
+		}
+		if threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("saturation threshold must be in (0, 1]")
+		}
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			p.goBackground(func(ctx context.Context) {
+				p.monitorSaturation(ctx, window, threshold, func() (int32, int32) {
+					stat := p.Stat()
+					return stat.AcquiredConns(), stat.MaxConns()
+				})
+			})
+			return nil
+		})
+		return nil
+	}
+}
+
+// monitorSaturation takes saturation_samples samples of usage, which returns the acquired and the maximum number of connections,
+// per window until ctx is done.
+func (p *Pool) monitorSaturation(ctx context.Context, window time.Duration, threshold float64, usage func() (acquired, maxConns int32)) {
+	ticker := time.NewTicker(window / saturation_samples)
+	defer ticker.Stop()
+	var samples [saturation_samples]bool
+	var next, saturated, taken int
+	var lastWarning time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		acquired, maxConns := usage()
+		sample := acquired >= maxConns
+		if samples[next] {
+			saturated--
+		}
+		if sample {
+			saturated++
+		}
+		samples[next] = sample
+		next = (next + 1) % saturation_samples
+		if taken < saturation_samples {
+			taken++
+		}
+		if taken < saturation_samples {
+			continue
+		}
+		fraction := float64(saturated) / saturation_samples
+		if fraction >= threshold && time.Since(lastWarning) >= window {
+			lastWarning = time.Now()
+			p.log(ctx, tracelog.LogLevelWarn, "pool saturated", map[string]any{
+				"saturated": fmt.Sprintf("%.0f%%", fraction*100),
+				"window":    window,
+				"max_conns": maxConns,
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const saturation_log = "pool saturated"
+
+// runSaturationMonitor runs monitorSaturation for duration with acquired of 4 connections in use throughout.
+func runSaturationMonitor(t *testing.T, window, duration time.Duration, threshold float64, acquired int32) *logRecorder {
+	t.Helper()
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	p.monitorSaturation(ctx, window, threshold, func() (int32, int32) { return acquired, 4 })
+	return &logs
+}
+
+func TestSaturationWarningSustained(t *testing.T) {
+	logs := runSaturationMonitor(t, 120*time.Millisecond, 600*time.Millisecond, 0.9, 4)
+	warnings := logs.find(saturation_log)
+	// The first warning needs a full window of samples, later ones at least a window apart.
+	if n := len(warnings); n < 2 || n > 4 {
+		t.Fatalf("%d warnings in 5 windows of sustained saturation, want 2 to 4", n)
+	}
+	if data := warnings[0].data; data["saturated"] != "100%" || data["max_conns"] != int32(4) {
+		t.Errorf("warning data = %v, want 100%% of 4 connections", data)
+	}
+}
+
+func TestSaturationWarningOnceWindowFull(t *testing.T) {
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	samples := 0
+	p.monitorSaturation(ctx, 60*time.Millisecond, 1, func() (int32, int32) {
+		if logs.count(saturation_log) > 0 {
+			cancel()
+		} else {
+			samples++
+		}
+		return 4, 4
+	})
+	if samples != saturation_samples {
+		t.Errorf("first warning after %d samples, want %d", samples, saturation_samples)
+	}
+}
+
+func TestSaturationWarningBelowThreshold(t *testing.T) {
+	if n := runSaturationMonitor(t, 60*time.Millisecond, 300*time.Millisecond, 0.5, 3).count(saturation_log); n != 0 {
+		t.Errorf("%d warnings with a connection always idle, want 0", n)
+	}
+}
+
+func TestSaturationWarningValidate(t *testing.T) {
+	for _, tt := range []struct {
+		window    time.Duration
+		threshold float64
+	}{{time.Millisecond, 0.5}, {time.Second, 0}, {time.Second, 1.5}} {
+		if err := WithSaturationWarning(tt.window, tt.threshold)(&options{}); err == nil {
+			t.Errorf("WithSaturationWarning(%s, %v) was accepted", tt.window, tt.threshold)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const reset_timeout = 5 * time.Second
+
+func (options *options) setRuntimeParam(param, value string) {
+	if options.runtimeparams == nil {
+		options.runtimeparams = make(map[string]string)
+	}
+	options.runtimeparams[param] = value
+}
+
+// DefaultIsolation sets default_transaction_isolation for every connection, which also applies to statements run outside an explicit transaction.
+// level is one of "read committed", "repeatable read" or "serializable". Per-transaction BeginTx options still take precedence.
+func WithDefaultIsolation(level string) Option {
+	return func(options *options) error {
+		level = strings.ToLower(strings.TrimSpace(level))
+		switch level {
+		case "read committed", "repeatable read", "serializable":
+		default:
+			return fmt.Errorf("unsupported transaction isolation level %q", level)
+		}
+		options.setRuntimeParam("default_transaction_isolation", level)
+		return nil
+	}
+}
+
+// Role issues SET ROLE role on every new connection, for deployments that log in as a bootstrap user and act as an application role.
+// The role is set again when a connection is released, so a SET ROLE or RESET ROLE run by one user does not leak into the next checkout.
+// Connections on which the role cannot be restored are discarded.
+func WithRole(role string) Option {
+	return func(options *options) error {
+		quoted, err := quoteIdent(role)
+		if err != nil {
+			return fmt.Errorf("role: %w", err)
+		}
+		sql := "SET ROLE " + quoted
+		options.afterconnect = append(options.afterconnect, func(ctx context.Context, conn *pgx.Conn) error {
+			if _, err := conn.Exec(ctx, sql); err != nil {
+				return fmt.Errorf("set role: %w", err)
+			}
+			return nil
+		})
+		options.afterrelease = append(options.afterrelease, func(conn *pgx.Conn) bool {
+			ctx, cancel := context.WithTimeout(context.Background(), reset_timeout)
+			defer cancel()
+			_, err := conn.Exec(ctx, sql)
+			return err == nil
+		})
+		return nil
+	}
+}
+
+var memoryUnitPattern = regexp.MustCompile(`^[0-9]+\s*(B|kB|MB|GB|TB)?$`)
+
+// WorkMem sets work_mem, e.g. "256MB", for every connection of the pool. It affects all queries on these connections,
+// and each sort or hash operation of a query may use up to this much memory, so prefer a dedicated pool for reporting.
+func WithWorkMem(size string) Option {
+	return func(options *options) error {
+		size = strings.TrimSpace(size)
+		if !memoryUnitPattern.MatchString(size) {
+			return fmt.Errorf("invalid work_mem %q, expected a number with an optional B, kB, MB, GB or TB unit", size)
+		}
+		options.setRuntimeParam("work_mem", size)
+		return nil
+	}
+}
+
+// DeallocateAllOnRelease deallocates all prepared statements of a connection when it is released, bounding the server memory used
+// by connections that run many distinct dynamic queries. Every checkout then prepares its statements again, which costs an extra
+// round trip per new statement; consider QueryExecModeExec or the simple protocol first. Connections that fail to deallocate are discarded.
+func WithDeallocateAllOnRelease() Option {
+	return func(options *options) error {
+		options.afterrelease = append(options.afterrelease, func(conn *pgx.Conn) bool {
+			ctx, cancel := context.WithTimeout(context.Background(), reset_timeout)
+			defer cancel()
+			return conn.DeallocateAll(ctx) == nil
+		})
+		return nil
+	}
+}
+
+// HardQueryLimit sets statement_timeout to d on every connection and verifies on connect, by reading the setting back, that the server applied it.
+// Connections where it does not match are rejected, so no statement on the pool can run longer than d even if the client stops waiting.
+// SET statement_timeout run on a connection can still change it for that session. d is rounded down to milliseconds.
+func WithHardQueryLimit(d time.Duration) Option {
+	return func(options *options) error {
+		if d < time.Millisecond {
+			return fmt.Errorf("hard query limit cannot be less than 1ms")
+		}
+		ms := strconv.FormatInt(d.Milliseconds(), 10)
+		options.setRuntimeParam("statement_timeout", ms)
+		options.validateconnect = append(options.validateconnect, func(ctx context.Context, conn *pgconn.PgConn) error {
+			results, err := conn.Exec(ctx, "SELECT setting FROM pg_settings WHERE name = 'statement_timeout'").ReadAll()
+			if err != nil {
+				return fmt.Errorf("verify statement_timeout: %w", err)
+			}
+			if len(results) != 1 || len(results[0].Rows) != 1 || string(results[0].Rows[0][0]) != ms {
+				return fmt.Errorf("verify statement_timeout: server did not apply %sms", ms)
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+// StartupOptions passes settings, e.g. {"statement_timeout": "5s"}, in the options startup parameter as -c name=value switches,
+// so the server applies them while the connection starts, before any query runs. Values are escaped as the server expects, so
+// they may contain spaces and backslashes. Switches are sorted by name; repeated use appends to the options parameter.
+func WithStartupOptions(settings map[string]string) Option {
+	return func(options *options) error {
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			if name == "" || strings.ContainsAny(name, "= \t\r\n\\") {
+				return fmt.Errorf("invalid startup option name %q", name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		switches := make([]string, 0, len(names)+1)
+		if current := options.runtimeparams["options"]; current != "" {
+			switches = append(switches, current)
+		}
+		for _, name := range names {
+			switches = append(switches, "-c "+escapeStartupOption(name+"="+settings[name]))
+		}
+		options.setRuntimeParam("options", strings.Join(switches, " "))
+		return nil
+	}
+}
+
+// escapeStartupOption escapes the backslashes and whitespace of a switch in the options parameter, which the server splits on whitespace.
+func escapeStartupOption(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || unicode.IsSpace(r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,302 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestDefaultIsolation(t *testing.T) {
+	var opt options
+	if err := WithDefaultIsolation(" Repeatable Read ")(&opt); err != nil {
+		t.Fatal(err)
+	}
+	if got := opt.runtimeparams["default_transaction_isolation"]; got != "repeatable read" {
+		t.Errorf("default_transaction_isolation = %q, want repeatable read", got)
+	}
+	for _, level := range []string{"", "read uncommitted", "snapshot"} {
+		if err := WithDefaultIsolation(level)(&options{}); err == nil {
+			t.Errorf("WithDefaultIsolation accepted %q", level)
+		}
+	}
+}
+
+func TestDefaultIsolationOnConnections(t *testing.T) {
+	p := testPool(t, WithDefaultIsolation("serializable"))
+	ctx := testContext(t)
+	level, err := Scalar[string](ctx, p, "SHOW default_transaction_isolation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != "serializable" {
+		t.Errorf("default_transaction_isolation = %q, want serializable", level)
+	}
+	if err := p.WithTx(ctx, func(tx *Tx) error {
+		level, err = Scalar[string](ctx, tx, "SHOW transaction_isolation")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if level != "serializable" {
+		t.Errorf("transaction_isolation = %q inside WithTx, want serializable", level)
+	}
+}
+
+func TestStartupOptions(t *testing.T) {
+	var opt options
+	if err := WithStartupOptions(map[string]string{"statement_timeout": "5s", "search_path": `app, "my schema"`})(&opt); err != nil {
+		t.Fatal(err)
+	}
+	if err := WithStartupOptions(map[string]string{"application_name": `C:\app`})(&opt); err != nil {
+		t.Fatal(err)
+	}
+	want := `-c search_path=app,\ "my\ schema" -c statement_timeout=5s -c application_name=C:\\app`
+	if got := opt.runtimeparams["options"]; got != want {
+		t.Errorf("options = %s, want %s", got, want)
+	}
+	for _, name := range []string{"", "a=b", "a b", `a\b`, "a\n"} {
+		if err := WithStartupOptions(map[string]string{name: "1"})(&options{}); err == nil {
+			t.Errorf("WithStartupOptions accepted the name %q", name)
+		}
+	}
+}
+
+func TestEscapeStartupOption(t *testing.T) {
+	for s, want := range map[string]string{
+		"work_mem=64MB": "work_mem=64MB",
+		"a=b c":         `a=b\ c`,
+		"a=\tb\nc":      "a=\\\tb\\\nc",
+		`a=b\c`:         `a=b\\c`,
+		`a=\ `:          `a=\\\ `,
+	} {
+		if got := escapeStartupOption(s); got != want {
+			t.Errorf("escapeStartupOption(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestStartupOptionsSent(t *testing.T) {
+	server := newRejectingServer(t, "28P01")
+	_, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithStartupOptions(map[string]string{"statement_timeout": "5s", "search_path": "a, b"}))
+	if err == nil {
+		t.Fatal("New succeeded against a server rejecting every login")
+	}
+	params := (<-server.startups).params
+	if want := `-c search_path=a,\ b -c statement_timeout=5s`; params["options"] != want {
+		t.Errorf("options startup parameter = %q, want %q", params["options"], want)
+	}
+}
+
+func TestStartupOptionsOnConnections(t *testing.T) {
+	p := testPool(t, WithStartupOptions(map[string]string{"statement_timeout": "5s", "search_path": "pg_catalog, public"}))
+	ctx := testContext(t)
+	for setting, want := range map[string]string{"statement_timeout": "5s", "search_path": "pg_catalog, public"} {
+		got, err := Scalar[string](ctx, p, "SHOW "+setting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", setting, got, want)
+		}
+	}
+}
+
+func TestWorkMem(t *testing.T) {
+	for size, want := range map[string]string{"256MB": "256MB", " 64 kB ": "64 kB", "1024": "1024", "1GB": "1GB"} {
+		var opt options
+		if err := WithWorkMem(size)(&opt); err != nil {
+			t.Errorf("WithWorkMem(%q) = %v", size, err)
+			continue
+		}
+		if got := opt.runtimeparams["work_mem"]; got != want {
+			t.Errorf("WithWorkMem(%q) set work_mem %q, want %q", size, got, want)
+		}
+	}
+	for _, size := range []string{"", "MB", "256mb", "256 MiB", "-1MB", "1.5GB", "256MB; SET role x"} {
+		if err := WithWorkMem(size)(&options{}); err == nil {
+			t.Errorf("WithWorkMem(%q) was accepted", size)
+		}
+	}
+	server := newRejectingServer(t, "53300")
+	New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithWorkMem("128MB"))
+	if got := (<-server.startups).params["work_mem"]; got != "128MB" {
+		t.Errorf("work_mem startup parameter = %q, want 128MB", got)
+	}
+}
+
+func TestWorkMemOnConnections(t *testing.T) {
+	p := testPool(t, WithWorkMem("96MB"))
+	got, err := Scalar[string](testContext(t), p, "SHOW work_mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "96MB" {
+		t.Errorf("work_mem = %q, want 96MB", got)
+	}
+}
+
+// drainQueries returns the queries server has received so far, leaving out the pings of pgx.
+func drainQueries(server *fakeServer) []string {
+	var queries []string
+	for {
+		select {
+		case sql := <-server.queries:
+			if sql != "-- ping" {
+				queries = append(queries, sql)
+			}
+		default:
+			return queries
+		}
+	}
+}
+
+func TestRole(t *testing.T) {
+	for _, role := range []string{"", "a\x00b"} {
+		if err := WithRole(role)(&options{}); err == nil {
+			t.Errorf("WithRole(%q) was accepted", role)
+		}
+	}
+	server := newAcceptingServer(t)
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithMaxConns(1),
+		WithRole(`app "reader"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	conn, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	// The role is set on connect and again after each release, the startup ping's and ours; release hooks run in the background.
+	deadline := time.Now().Add(time.Second)
+	var queries []string
+	for len(queries) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		queries = append(queries, drainQueries(server)...)
+	}
+	const set_role = `SET ROLE "app ""reader"""`
+	if len(queries) != 3 || queries[0] != set_role || queries[1] != set_role || queries[2] != set_role {
+		t.Errorf("queries = %q, want %s on connect and after each of two releases", queries, set_role)
+	}
+}
+
+func TestRoleRestoredAfterRelease(t *testing.T) {
+	role := testName("test_role")
+	testObject(t, "CREATE ROLE "+role+" NOLOGIN", "DROP ROLE "+role)
+	testObject(t, "GRANT "+role+" TO CURRENT_USER", "REVOKE "+role+" FROM CURRENT_USER")
+	p := testPool(t, WithMaxConns(1), WithRole(role))
+	ctx := testContext(t)
+	current := func() string {
+		t.Helper()
+		user, err := Scalar[string](ctx, p, "SELECT current_user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	if user := current(); user != role {
+		t.Fatalf("current_user = %q, want the role %q", user, role)
+	}
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "RESET ROLE"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	if user := current(); user != role {
+		t.Errorf("current_user = %q after a checkout ran RESET ROLE, want %q", user, role)
+	}
+}
+
+func TestDeallocateAllOnRelease(t *testing.T) {
+	server := newAcceptingServer(t)
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"), WithMaxConns(1),
+		WithDeallocateAllOnRelease())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	conn, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	// Once after the startup ping's release and once after ours; release hooks run in the background.
+	deadline := time.Now().Add(time.Second)
+	var queries []string
+	for len(queries) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		queries = append(queries, drainQueries(server)...)
+	}
+	if len(queries) != 2 || queries[0] != "deallocate all" || queries[1] != "deallocate all" {
+		t.Errorf("queries = %q, want deallocate all after each of two releases", queries)
+	}
+}
+
+func TestDeallocateAllBetweenCheckouts(t *testing.T) {
+	p := testPool(t, WithMaxConns(1), WithDeallocateAllOnRelease())
+	ctx := testContext(t)
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := conn.Conn().PgConn().PID()
+	if _, err := conn.Conn().Prepare(ctx, "test_statement", "SELECT $1::int"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	conn, err = p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if conn.Conn().PgConn().PID() != pid {
+		t.Fatal("the second checkout got another connection")
+	}
+	var n int
+	if err := conn.QueryRow(ctx, "SELECT count(*) FROM pg_prepared_statements", pgx.QueryExecModeSimpleProtocol).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d prepared statements left on the connection after release, want 0", n)
+	}
+}
+
+func TestHardQueryLimit(t *testing.T) {
+	if err := WithHardQueryLimit(time.Microsecond)(&options{}); err == nil {
+		t.Error("WithHardQueryLimit accepted a limit under 1ms")
+	}
+	// The fake server takes the setting but reports nothing for it, as a pooler dropping startup parameters would.
+	server := newAcceptingServer(t)
+	_, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLMode("disable"),
+		WithHardQueryLimit(1500*time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "server did not apply 1500ms") {
+		t.Errorf("New error = %v, want the verification to fail", err)
+	}
+	if got := (<-server.startups).params["statement_timeout"]; got != "1500" {
+		t.Errorf("statement_timeout startup parameter = %q, want 1500", got)
+	}
+}
+
+func TestHardQueryLimitCancels(t *testing.T) {
+	p := testPool(t, WithHardQueryLimit(100*time.Millisecond))
+	ctx := testContext(t)
+	start := time.Now()
+	_, err := p.Exec(ctx, "SELECT pg_sleep(5)")
+	if sqlState(err) != "57014" {
+		t.Fatalf("pg_sleep(5) under a 100ms limit = %v, want query_canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the query was cancelled after %s, want about 100ms", elapsed)
+	}
+	if _, err := p.Exec(ctx, "SELECT pg_sleep(0.01)"); err != nil {
+		t.Errorf("a query within the limit failed: %v", err)
+	}
+}
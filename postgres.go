@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/tracelog"
 )
@@ -26,24 +30,98 @@ type Option func(option *options) error
 
 type options struct {
 	host                  *net.IP
+	service               *string
+	servicefile           *string
+	hosts                 []string
 	port                  *int
 	database              *string
 	user                  *string
 	pass                  *string
 	sslmode               *string
+	sslfallback           bool
+	maxreplicationlag     time.Duration
+	gradualwarmup         bool
+	notifycoalescing      time.Duration
+	readfallback          *readFallback
+	startuphooks          []func(context.Context, *Pool) error
 	maxconns              *int
 	minconns              *int
 	maxconnlifetime       *time.Duration
 	maxconnidletime       *time.Duration
 	healthcheckperiod     *time.Duration
+	connecttimeout        *time.Duration
 	maxconnlifetimejitter *time.Duration
 	tracelogger           *tracelog.TraceLog
+	configlogging         bool
+	name                  *string
+	beforeconnect         []func(context.Context, *pgx.ConnConfig) error
+	afterconnect          []func(context.Context, *pgx.Conn) error
+	beforeacquire         []func(context.Context, *pgx.Conn) bool
+	validateconnect       []pgconn.ValidateConnectFunc
+	afterrelease          []func(*pgx.Conn) bool
+	beforeclose           []func(*pgx.Conn)
+	nullaszero            bool
+	csvformat             CSVFormat
+	retrypredicate        func(error) bool
+	txretries             int
+	onnew                 []func(*Pool) error
+	tracers               []func(name string) pgx.QueryTracer
+	runtimeparams         map[string]string
+	callertagging         bool
+	startupverification   bool
+	dialer                []func(dialer *net.Dialer, network string)
+	dialhooks             []func(net.Conn) error
+	asyncping             *asyncPing
+	fallbackappname       *string
+	rewriter              func(ctx context.Context, sql string) string
+	resultformat          *int16
+	credentials           CredentialProvider
+	credentialrefresh     time.Duration
+	connstring            url.Values
 }
 
 var ErrNoRows error = pgx.ErrNoRows
 
-// Creates a new connection pool with parameters. If no parameters are passed, the default settings will be applied. Immediately after connection, a ping is carried out for verification.
-func New(ctx context.Context, opts ...Option) (*pgxpool.Pool, error) {
+// Pool is a connection pool returned by New. All pgxpool.Pool methods are available through embedding.
+type Pool struct {
+	*pgxpool.Pool
+	name string
+	sem  *prioritySemaphore
+	cfg  *helperConfig
+	tl   *levelTracer
+
+	cache       *queryCache
+	events      *eventSender
+	credentials *credentialCache
+
+	bg        context.Context // cancelled on Close
+	stop      context.CancelFunc
+	wg        sync.WaitGroup
+	bgMu      sync.Mutex
+	closed    bool
+	onclose   []func()
+	closeOnce sync.Once
+
+	ready      chan struct{}
+	startup    func(context.Context) error
+	startupRun sync.Mutex
+	startupMu  sync.Mutex
+	startupErr error
+	startupEnd bool // the background startup ping gave up, Healthy retries it
+
+	healthMu  sync.Mutex
+	healthAt  time.Time
+	healthErr error
+	maxLag    time.Duration
+
+	recorder HelperRecorder
+	coalesce time.Duration
+
+	readFallback *readFallback
+}
+
+// Creates a new connection pool with parameters. If no parameters are passed, the default settings will be applied. Immediately after connection, a ping is carried out for verification. If ctx is done before New completes, the pool is closed and the context error is returned.
+func New(ctx context.Context, opts ...Option) (*Pool, error) {
 	var opt options
 	for _, option := range opts {
 		if err := option(&opt); err != nil {
@@ -89,12 +167,30 @@ func New(ctx context.Context, opts ...Option) (*pgxpool.Pool, error) {
 	if opt.sslmode != nil {
 		val.Set("sslmode", *opt.sslmode)
 	}
+	if opt.service != nil {
+		val.Set("service", *opt.service)
+		if opt.servicefile != nil {
+			val.Set("servicefile", *opt.servicefile)
+		}
+	}
+
+	for key, values := range opt.connstring {
+		val[key] = values
+	}
 
+	host := fmt.Sprintf("%s:%d", *ip, port)
+	if len(opt.hosts) > 0 {
+		host = hostList(opt.hosts, port)
+	}
+	userinfo := url.UserPassword(user, pass)
+	if opt.service != nil {
+		host, database, userinfo = serviceOverrides(&opt, host)
+	}
 	url := &url.URL{
 		Scheme:   self_name,
-		Host:     fmt.Sprintf("%s:%d", *ip, port),
+		Host:     host,
 		Path:     database,
-		User:     url.UserPassword(user, pass),
+		User:     userinfo,
 		RawQuery: val.Encode(),
 	}
 
@@ -102,9 +198,41 @@ func New(ctx context.Context, opts ...Option) (*pgxpool.Pool, error) {
 	if err != nil {
 		return nil, err
 	}
+	var name string
+	if opt.name != nil {
+		name = *opt.name
+	}
+	var tracers []pgx.QueryTracer
+	var tl *levelTracer
 	if opt.tracelogger != nil {
-		conCfg.ConnConfig.Tracer = opt.tracelogger
+		if name != "" {
+			opt.tracelogger.Logger = &namedLogger{name: name, logger: opt.tracelogger.Logger}
+		}
+		tl = newLevelTracer(opt.tracelogger)
+		tracers = append(tracers, tl)
+	}
+	for _, tracer := range opt.tracers {
+		tracers = append(tracers, tracer(name))
+	}
+	switch len(tracers) {
+	case 0:
+	case 1:
+		conCfg.ConnConfig.Tracer = tracers[0]
+	default:
+		conCfg.ConnConfig.Tracer = multitracer.New(tracers...)
 	}
+	for param, value := range opt.runtimeparams {
+		conCfg.ConnConfig.RuntimeParams[param] = value
+	}
+	if _, ok := conCfg.ConnConfig.RuntimeParams["application_name"]; !ok && opt.fallbackappname != nil {
+		conCfg.ConnConfig.RuntimeParams["application_name"] = *opt.fallbackappname
+	}
+	if err := applyCredentials(&opt); err != nil {
+		return nil, err
+	}
+	applyDialer(conCfg, &opt)
+	applySSLFallback(conCfg, &opt, tl)
+	applyHooks(conCfg, &opt)
 	if opt.maxconns != nil && *opt.maxconns != 0 {
 		conCfg.MaxConns = int32(*opt.maxconns)
 	}
@@ -120,19 +248,186 @@ func New(ctx context.Context, opts ...Option) (*pgxpool.Pool, error) {
 	if opt.healthcheckperiod != nil {
 		conCfg.HealthCheckPeriod = *opt.healthcheckperiod
 	}
+	if opt.connecttimeout != nil {
+		conCfg.ConnConfig.ConnectTimeout = *opt.connecttimeout
+	}
 	if opt.maxconnlifetimejitter != nil {
 		conCfg.MaxConnLifetimeJitter = *opt.maxconnlifetimejitter
 	}
+	if jitter := conCfg.MaxConnLifetimeJitter; jitter > 0 {
+		switch {
+		case conCfg.MaxConnLifetime <= 0:
+			return nil, fmt.Errorf("max connection life time jitter has no effect without max connection life time")
+		case jitter > conCfg.MaxConnLifetime:
+			return nil, fmt.Errorf("max connection life time jitter %s exceeds max connection life time %s", jitter, conCfg.MaxConnLifetime)
+		}
+	}
+	warmup := applyGradualWarmup(conCfg, &opt)
+	if opt.configlogging && opt.tracelogger != nil {
+		logConfig(ctx, opt.tracelogger, conCfg)
+	}
 
-	pool, err := pgxpool.NewWithConfig(ctx, conCfg)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bg, stop := context.WithCancel(context.Background())
+	createCtx := ctx
+	if warmup {
+		// the ramp outlives New, so it must not be cut short when the caller cancels ctx
+		createCtx = warmupContext(bg)
+	}
+	pool, err := pgxpool.NewWithConfig(createCtx, conCfg)
 	if err != nil {
+		stop()
 		return nil, err
 	}
 
-	if err := pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("ping postgres: %s", err)
+	checkStartup := func(ctx context.Context) error {
+		if err := pool.Ping(ctx); err != nil {
+			return fmt.Errorf("ping postgres: %w", wrapAuthenticationError(wrapConnectError(err), conCfg.ConnConfig.User))
+		}
+		if opt.startupverification {
+			return verifyStartup(ctx, pool, conCfg.ConnConfig)
+		}
+		return nil
+	}
+	if opt.asyncping == nil {
+		if err := checkStartup(ctx); err != nil {
+			stop()
+			pool.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+	var formats pgx.QueryResultFormats
+	if opt.resultformat != nil {
+		formats = pgx.QueryResultFormats{*opt.resultformat}
+	}
+	retryable := DefaultRetryPredicate
+	if opt.retrypredicate != nil {
+		retryable = opt.retrypredicate
+	}
+	p := &Pool{
+		Pool:         pool,
+		name:         name,
+		sem:          newPrioritySemaphore(int(conCfg.MaxConns)),
+		tl:           tl,
+		maxLag:       opt.maxreplicationlag,
+		coalesce:     opt.notifycoalescing,
+		readFallback: opt.readfallback,
+		cfg: &helperConfig{
+			nullAsZero: opt.nullaszero,
+			csv:        opt.csvformat,
+			retryable:  retryable,
+			txRetries:  opt.txretries,
+			tagCaller:  opt.callertagging,
+			rewrite:    opt.rewriter,
+			formats:    formats,
+		},
+	}
+	p.bg, p.stop = bg, stop
+	p.ready = make(chan struct{})
+	for _, hook := range opt.onnew {
+		if err := hook(p); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	runStartupHooks := func(ctx context.Context) error {
+		for _, hook := range opt.startuphooks {
+			if err := hook(ctx, p); err != nil {
+				return fmt.Errorf("startup hook: %w", err)
+			}
+		}
+		return nil
+	}
+	if opt.asyncping == nil {
+		if err := runStartupHooks(ctx); err != nil {
+			p.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		close(p.ready)
+		p.recordHealth(nil)
+	} else {
+		p.startup = func(ctx context.Context) error {
+			if err := checkStartup(ctx); err != nil {
+				return err
+			}
+			return runStartupHooks(ctx)
+		}
+		p.goBackground(func(ctx context.Context) {
+			p.startupPing(ctx, opt.asyncping.attempts, opt.asyncping.backoff)
+		})
+	}
+	return p, nil
+}
+
+// Close stops the background work started by the options and closes all connections. It blocks until all connections are returned to the pool and closed.
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		p.bgMu.Lock()
+		p.closed = true
+		p.bgMu.Unlock()
+		p.stop()
+		p.wg.Wait()
+		for _, fn := range p.onclose {
+			fn()
+		}
+		p.Pool.Close()
+	})
+}
+
+// CloseCtx is Close returning ctx.Err() if ctx is done before Close completes. Close then keeps running in the background:
+// connections still in use are closed when they are released, so they may still be draining after CloseCtx returns.
+func (p *Pool) CloseCtx(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Close()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// goBackground runs fn in a goroutine that Close cancels and waits for. It reports false if the pool is already closed.
+func (p *Pool) goBackground(fn func(ctx context.Context)) bool {
+	p.bgMu.Lock()
+	defer p.bgMu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn(p.bg)
+	}()
+	return true
+}
+
+// Name returns the name set with WithName.
+func (p *Pool) Name() string {
+	return p.name
+}
+
+func (p *Pool) helpers() *helperConfig {
+	return p.cfg
+}
+
+// Name identifies the pool in log entries and metric labels, useful when an application has several pools.
+func WithName(name string) Option {
+	return func(options *options) error {
+		options.name = &name
+		return nil
 	}
-	return pool, nil
 }
 
 // default host=127.0.0.1
@@ -200,6 +495,106 @@ func WithSSLMode(mode string) Option {
 			mode = disable_ssl_mode
 		}
 		options.sslmode = &mode
+		options.sslfallback = false
+		return nil
+	}
+}
+
+// FallbackApplicationName is sent as application_name when no application_name is configured, like libpq's fallback_application_name.
+// An explicit application_name always wins, so libraries can provide a default that keeps connections identifiable through poolers such as pgbouncer.
+func WithFallbackApplicationName(name string) Option {
+	return func(options *options) error {
+		if name == "" {
+			return fmt.Errorf("fallback application name cannot be empty")
+		}
+		options.fallbackappname = &name
+		return nil
+	}
+}
+
+// Service takes the connection settings from the service name of a libpq service file (pg_service.conf), read from file or, when
+// file is empty, from PGSERVICEFILE or ~/.pg_service.conf. Settings of the other options override the service's only when
+// passed explicitly, and WithPass applies only together with WithUser; the package defaults are not applied over the service.
+func WithService(name, file string) Option {
+	return func(options *options) error {
+		if name == "" {
+			return fmt.Errorf("service name cannot be empty")
+		}
+		options.service = &name
+		if file != "" {
+			options.servicefile = &file
+		}
+		return nil
+	}
+}
+
+// serviceOverrides returns the URL parts of the connection settings that were set explicitly, so the others come from the service.
+func serviceOverrides(opt *options, host string) (string, string, *url.Userinfo) {
+	switch {
+	case opt.port == nil && len(opt.hosts) > 0:
+		host = hostList(opt.hosts, 0)
+	case opt.port == nil && opt.host != nil:
+		host = opt.host.String()
+	case opt.host != nil || len(opt.hosts) > 0:
+	case opt.port != nil:
+		host = fmt.Sprintf(":%d", *opt.port)
+	default:
+		host = ""
+	}
+	database := "/"
+	if opt.database != nil {
+		database += *opt.database
+	}
+	var userinfo *url.Userinfo
+	switch {
+	case opt.user != nil && opt.pass != nil:
+		userinfo = url.UserPassword(*opt.user, *opt.pass)
+	case opt.user != nil:
+		userinfo = url.User(*opt.user)
+	}
+	return host, database, userinfo
+}
+
+// ConnString merges extra connection parameters in URL query form, e.g. "options=-c%20geqo%3Doff&target_session_attrs=read-write",
+// into the connection string built from the other options. Only the keys present in extra are overridden. Can be passed several times.
+func WithConnString(extra string) Option {
+	return func(options *options) error {
+		values, err := url.ParseQuery(strings.TrimPrefix(extra, "?"))
+		if err != nil {
+			return fmt.Errorf("parse connection string fragment: %w", err)
+		}
+		if options.connstring == nil {
+			options.connstring = url.Values{}
+		}
+		for key, value := range values {
+			options.connstring[key] = value
+		}
+		return nil
+	}
+}
+
+// StartupHook runs fn once, after the pool is built and the startup ping has succeeded and before New returns, e.g. to
+// CREATE EXTENSION IF NOT EXISTS or run migrations. If fn fails, the pool is closed and New returns the error. With
+// WithAsyncStartupPing, fn runs in the background after the ping instead and is retried with it until both succeed.
+// Hooks run in the order they are passed.
+func WithStartupHook(fn func(ctx context.Context, p *Pool) error) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("startup hook cannot be nil")
+		}
+		options.startuphooks = append(options.startuphooks, fn)
+		return nil
+	}
+}
+
+// ConnectTimeout limits each connection attempt to one server address, so with WithHosts a dead first host costs at most timeout before
+// the next one is tried. When all attempts fail, the error lists every address tried with the reason it failed. default no limit
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(options *options) error {
+		if timeout < 0 {
+			return fmt.Errorf("connect timeout cannot be less than zero")
+		}
+		options.connecttimeout = &timeout
 		return nil
 	}
 }
@@ -235,6 +630,7 @@ func WithMinConns(conns int) Option {
 }
 
 // MaxConnLifetime is the duration since creation after which a connection will be automatically closed.
+// Zero keeps the default of one hour.
 func WithMaxConnLifeTime(lifetime time.Duration) Option {
 	return func(options *options) error {
 		if lifetime < 0 {
@@ -280,6 +676,7 @@ func WithHealthCheckPeriod(period time.Duration) Option {
 }
 
 // MaxConnLifetimeJitter is the duration after MaxConnLifetime to randomly decide to close a connection. This helps prevent all connections from being closed at the exact same time, starving the pool.
+// New fails if the jitter exceeds MaxConnLifetime, or if MaxConnLifetime was set to zero with pool_max_conn_lifetime in WithConnString.
 func WithMaxConnLifeTimeJitter(jitter time.Duration) Option {
 	return func(options *options) error {
 		if jitter < 0 {
@@ -293,3 +690,78 @@ func WithMaxConnLifeTimeJitter(jitter time.Duration) Option {
 		return nil
 	}
 }
+
+// NullAsZero makes the single-column scans of the package helpers (Scalar, Select and Get into non-struct types) treat SQL NULL as the Go zero value instead of returning an error. Off by default.
+func WithNullAsZero() Option {
+	return func(options *options) error {
+		options.nullaszero = true
+		return nil
+	}
+}
+
+// CSVFormat is used by the CSV helpers. By default fields are comma separated and NULL is an empty field.
+func WithCSVFormat(format CSVFormat) Option {
+	return func(options *options) error {
+		options.csvformat = format
+		return nil
+	}
+}
+
+// CallerTagging makes the package helpers append the calling function and file:line as a SQL comment, so it is visible in pg_stat_activity and server logs.
+// It costs a stack walk per call and gives every call site its own prepared statement. Off by default. The statements
+// WithQueryRewriter leaves alone are not tagged either.
+func WithCallerTagging() Option {
+	return func(options *options) error {
+		options.callertagging = true
+		return nil
+	}
+}
+
+// StartupVerification makes New check that the connection reached the configured database and that the user can run queries,
+// returning a descriptive error otherwise.
+func WithStartupVerification() Option {
+	return func(options *options) error {
+		options.startupverification = true
+		return nil
+	}
+}
+
+func verifyStartup(ctx context.Context, pool *pgxpool.Pool, cfg *pgx.ConnConfig) error {
+	var database string
+	if err := pool.QueryRow(ctx, "SELECT current_database()").Scan(&database); err != nil {
+		return fmt.Errorf("verify startup: user %q cannot query database %q: %w", cfg.User, cfg.Database, err)
+	}
+	if database != cfg.Database {
+		return fmt.Errorf("verify startup: connected to database %q, expected %q", database, cfg.Database)
+	}
+	return nil
+}
+
+// QueryRewriter is called with the SQL of every statement sent by the package helpers and the returned SQL is sent instead.
+// Statements run directly through the embedded pgxpool.Pool are not rewritten, nor are those the package sends on its own behalf:
+// the settings of WithTxSearchPath, WithTxVars and WithBudget, CopyBetween, and the queries of the health checks, warmup and options.
+// The rewriter can change the meaning of any query, break prepared statement reuse and bypass argument binding, so keep it simple
+// and never interpolate untrusted input.
+func WithQueryRewriter(fn func(ctx context.Context, sql string) string) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("query rewriter cannot be nil")
+		}
+		options.rewriter = fn
+		return nil
+	}
+}
+
+// DefaultResultFormat forces the result format of all columns of queries run by the package helpers: text=0, binary=1.
+// By default pgx picks binary for the types it can decode. The format is only applied with the statement-describing exec modes
+// (cache statement, cache describe, describe exec); it is ignored under QueryExecModeExec and the simple protocol, which use text.
+// Forcing binary fails for columns of types pgx has no binary decoder for.
+func WithDefaultResultFormat(format int16) Option {
+	return func(options *options) error {
+		if format != pgx.TextFormatCode && format != pgx.BinaryFormatCode {
+			return fmt.Errorf("result format must be 0 (text) or 1 (binary)")
+		}
+		options.resultformat = &format
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PriorityConn is a connection acquired with AcquireWithPriority. Release must be called instead of the embedded Conn.Release.
+type PriorityConn struct {
+	*pgxpool.Conn
+	sem  *prioritySemaphore
+	once sync.Once
+}
+
+// Release returns the connection to the pool and hands its slot to the next waiter, high-priority waiters first.
+func (c *PriorityConn) Release() {
+	c.once.Do(func() {
+		c.Conn.Release()
+		c.sem.release()
+	})
+}
+
+// AcquireWithPriority acquires a connection, serving high-priority waiters before low-priority ones when the pool is saturated.
+// Only callers of AcquireWithPriority take part in the ordering; plain Acquire calls bypass it.
+func (p *Pool) AcquireWithPriority(ctx context.Context, high bool) (*PriorityConn, error) {
+	if err := p.sem.acquire(ctx, high); err != nil {
+		return nil, err
+	}
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		p.sem.release()
+		return nil, err
+	}
+	return &PriorityConn{Conn: conn, sem: p.sem}, nil
+}
+
+type prioritySemaphore struct {
+	mu   sync.Mutex
+	free int
+	high list.List
+	low  list.List
+}
+
+func newPrioritySemaphore(size int) *prioritySemaphore {
+	return &prioritySemaphore{free: size}
+}
+
+func (s *prioritySemaphore) acquire(ctx context.Context, high bool) error {
+	s.mu.Lock()
+	if s.free > 0 && s.high.Len() == 0 && (high || s.low.Len() == 0) {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	queue := &s.low
+	if high {
+		queue = &s.high
+	}
+	ready := make(chan struct{})
+	elem := queue.PushBack(ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// the slot was handed over while the context was being cancelled
+			s.mu.Unlock()
+			s.release()
+		default:
+			queue.Remove(elem)
+			s.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *prioritySemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, queue := range []*list.List{&s.high, &s.low} {
+		if elem := queue.Front(); elem != nil {
+			queue.Remove(elem)
+			close(elem.Value.(chan struct{}))
+			return
+		}
+	}
+	s.free++
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrioritySemaphoreFreeSlots(t *testing.T) {
+	s := newPrioritySemaphore(2)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := s.acquire(ctx, i == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.free != 0 {
+		t.Fatalf("free = %d after taking both slots", s.free)
+	}
+	s.release()
+	s.release()
+	if s.free != 2 {
+		t.Errorf("free = %d after releasing both slots, want 2", s.free)
+	}
+}
+
+// waitQueued waits until the semaphore has high and low waiters queued.
+func waitQueued(t *testing.T, s *prioritySemaphore, high, low int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		h, l := s.high.Len(), s.low.Len()
+		s.mu.Unlock()
+		if h == high && l == low {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d high and %d low waiters, want %d and %d", h, l, high, low)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPrioritySemaphoreServesHighFirst(t *testing.T) {
+	s := newPrioritySemaphore(1)
+	ctx := context.Background()
+	if err := s.acquire(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	wait := func(name string, high bool) {
+		defer wg.Done()
+		if err := s.acquire(ctx, high); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+		s.release()
+	}
+	wg.Add(1)
+	go wait("low", false)
+	waitQueued(t, s, 0, 1)
+	wg.Add(1)
+	go wait("high", true)
+	waitQueued(t, s, 1, 1)
+	s.release()
+	wg.Wait()
+	if len(order) != 2 || order[0] != "high" || order[1] != "low" {
+		t.Errorf("slots were handed out in the order %v, want [high low]", order)
+	}
+}
+
+func TestPrioritySemaphoreLowWaitsBehindQueue(t *testing.T) {
+	s := newPrioritySemaphore(1)
+	if err := s.acquire(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.acquire(context.Background(), false) }()
+	waitQueued(t, s, 0, 1)
+	s.release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s.free != 0 {
+		t.Errorf("free = %d, the released slot should have gone to the waiter", s.free)
+	}
+}
+
+func TestPrioritySemaphoreCancel(t *testing.T) {
+	s := newPrioritySemaphore(1)
+	if err := s.acquire(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.acquire(ctx, true) }()
+	waitQueued(t, s, 1, 0)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire returned %v, want context.Canceled", err)
+	}
+	waitQueued(t, s, 0, 0)
+	s.release()
+	if s.free != 1 {
+		t.Errorf("free = %d after the cancelled waiter left, want 1", s.free)
+	}
+}
+
+func TestAcquireWithPriority(t *testing.T) {
+	p := testPool(t, WithMaxConns(1))
+	ctx := testContext(t)
+	conn, err := p.AcquireWithPriority(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan *PriorityConn, 1)
+	go func() {
+		c, err := p.AcquireWithPriority(ctx, true)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- c
+	}()
+	waitQueued(t, p.sem, 1, 0)
+	conn.Release()
+	conn.Release() // a second Release must not free another slot
+	c := <-acquired
+	if c == nil {
+		return
+	}
+	defer c.Release()
+	if p.sem.free != 0 {
+		t.Errorf("free = %d after a double Release, want 0", p.sem.free)
+	}
+}
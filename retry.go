@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultRetryPredicate reports whether err is worth retrying: serialization failures, deadlocks,
+// connection errors and errors pgconn marks as safe to retry.
+func DefaultRetryPredicate(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := sqlState(err)
+	switch {
+	case code == "40001", code == "40P01":
+		return true
+	case strings.HasPrefix(code, "08"):
+		return true
+	}
+	return pgconn.SafeToRetry(err)
+}
+
+// RetryPredicate decides which errors the retrying helpers retry. default DefaultRetryPredicate
+func WithRetryPredicate(fn func(err error) bool) Option {
+	return func(options *options) error {
+		if fn == nil {
+			return fmt.Errorf("retry predicate cannot be nil")
+		}
+		options.retrypredicate = fn
+		return nil
+	}
+}
+
+// TxRetries is the number of times the WithTx helpers rerun a transaction that failed with a retryable error. default 0
+func WithTxRetries(retries int) Option {
+	return func(options *options) error {
+		if retries < 0 {
+			return fmt.Errorf("transaction retries cannot be less than zero")
+		}
+		options.txretries = retries
+		return nil
+	}
+}
+
+// RetryPolicy bounds the retries of Do.
+type RetryPolicy struct {
+	MaxAttempts int              // total number of calls, including the first; 0 means no limit besides MaxElapsed and ctx
+	MaxElapsed  time.Duration    // no attempt is started after this much time since the first one; 0 means no limit
+	Backoff     time.Duration    // wait before the second attempt, doubled after every further attempt; required without limits
+	MaxBackoff  time.Duration    // upper bound of the wait; 0 means no bound
+	Retryable   func(error) bool // errors worth retrying; nil means DefaultRetryPredicate
+}
+
+// Do calls fn until it succeeds, returns an error the policy does not retry, or the policy's attempt or time budget is spent,
+// and returns the last error. fn is given a context that is cancelled once MaxElapsed has passed, so a running attempt
+// does not outlive the budget either. Do stops waiting as soon as ctx is done. A policy with neither MaxAttempts, MaxElapsed
+// nor Backoff is refused, since it would retry without a pause until ctx is done.
+func Do(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	if policy.MaxAttempts < 0 || policy.MaxElapsed < 0 || policy.Backoff < 0 || policy.MaxBackoff < 0 {
+		return fmt.Errorf("retry policy values cannot be less than zero")
+	}
+	if policy.MaxAttempts == 0 && policy.MaxElapsed == 0 && policy.Backoff == 0 {
+		return fmt.Errorf("retry policy without MaxAttempts or MaxElapsed needs a Backoff")
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryPredicate
+	}
+	if policy.MaxElapsed > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.MaxElapsed)
+		defer cancel()
+	}
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		wait := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return err
+		case <-wait.C:
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
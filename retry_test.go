@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDefaultRetryPredicate(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"serialization failure", pgError("40001"), true},
+		{"deadlock", pgError("40P01"), true},
+		{"connection failure", pgError("08006"), true},
+		{"unique violation", pgError("23505"), false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := DefaultRetryPredicate(tt.err); got != tt.want {
+			t.Errorf("DefaultRetryPredicate(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryOptionsValidate(t *testing.T) {
+	if err := WithRetryPredicate(nil)(&options{}); err == nil {
+		t.Error("WithRetryPredicate accepted nil")
+	}
+	if err := WithTxRetries(-1)(&options{}); err == nil {
+		t.Error("WithTxRetries accepted a negative count")
+	}
+	var opt options
+	if err := WithTxRetries(3)(&opt); err != nil || opt.txretries != 3 {
+		t.Errorf("WithTxRetries(3) set %d, %v", opt.txretries, err)
+	}
+}
+
+func TestTxRetries(t *testing.T) {
+	retry := errors.New("retry me")
+	p := testPool(t, WithTxRetries(2), WithRetryPredicate(func(err error) bool { return errors.Is(err, retry) }))
+	ctx := testContext(t)
+	attempts := 0
+	err := p.WithTx(ctx, func(tx *Tx) error {
+		attempts++
+		if attempts < 3 {
+			return retry
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("WithTx returned %v after %d attempts, want success after 3", err, attempts)
+	}
+
+	attempts = 0
+	err = p.WithTx(ctx, func(tx *Tx) error {
+		attempts++
+		return retry
+	})
+	if !errors.Is(err, retry) || attempts != 3 {
+		t.Errorf("WithTx returned %v after %d attempts, want the error after 3", err, attempts)
+	}
+
+	attempts = 0
+	other := errors.New("do not retry")
+	err = p.WithTx(ctx, func(tx *Tx) error {
+		attempts++
+		return other
+	})
+	if !errors.Is(err, other) || attempts != 1 {
+		t.Errorf("WithTx returned %v after %d attempts, want the error after 1", err, attempts)
+	}
+}
+
+func TestTxRetriesOffByDefault(t *testing.T) {
+	p := testPool(t)
+	attempts := 0
+	err := p.WithTx(testContext(t), func(tx *Tx) error {
+		attempts++
+		return pgError("40001")
+	})
+	if sqlState(err) != "40001" || attempts != 1 {
+		t.Errorf("WithTx returned %v after %d attempts, want the error after 1", err, attempts)
+	}
+}
+
+func TestDoAttemptLimit(t *testing.T) {
+	var calls int
+	err := Do(context.Background(), RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, func(context.Context) error {
+		calls++
+		return pgError("40001")
+	})
+	if sqlState(err) != "40001" || calls != 3 {
+		t.Errorf("Do = %v after %d calls, want the serialization failure after 3", err, calls)
+	}
+
+	calls = 0
+	err = Do(context.Background(), RetryPolicy{MaxAttempts: 3}, func(context.Context) error {
+		calls++
+		if calls == 2 {
+			return nil
+		}
+		return pgError("40P01")
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Do = %v after %d calls, want success on the second", err, calls)
+	}
+
+	calls = 0
+	err = Do(context.Background(), RetryPolicy{MaxAttempts: 3}, func(context.Context) error {
+		calls++
+		return pgError("23505")
+	})
+	if sqlState(err) != "23505" || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want a non-retryable error returned at once", err, calls)
+	}
+}
+
+func TestDoDeadline(t *testing.T) {
+	var calls int
+	start := time.Now()
+	err := Do(context.Background(), RetryPolicy{MaxElapsed: 50 * time.Millisecond, Backoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+		func(ctx context.Context) error {
+			calls++
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("attempt context has no deadline")
+			}
+			return pgError("40001")
+		})
+	if elapsed := time.Since(start); sqlState(err) != "40001" || elapsed > time.Second {
+		t.Errorf("Do = %v after %s, want the last error once MaxElapsed has passed", err, elapsed)
+	}
+	if calls < 2 {
+		t.Errorf("Do made %d calls within MaxElapsed, want several", calls)
+	}
+
+	// An attempt still running at the cutoff sees its context cancelled and is not retried.
+	calls = 0
+	err = Do(context.Background(), RetryPolicy{MaxElapsed: 20 * time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return pgError("08006")
+	})
+	if sqlState(err) != "08006" || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want the attempt cut off by MaxElapsed and no retry", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err := Do(ctx, RetryPolicy{Backoff: time.Hour}, func(context.Context) error {
+		calls++
+		return pgError("40001")
+	}); sqlState(err) != "40001" || calls != 1 {
+		t.Errorf("Do with a cancelled context = %v after %d calls, want one call", err, calls)
+	}
+}
+
+func TestDoRejectsNegativePolicy(t *testing.T) {
+	for _, policy := range []RetryPolicy{{MaxAttempts: -1}, {MaxElapsed: -1}, {Backoff: -1}, {MaxBackoff: -1}} {
+		if err := Do(context.Background(), policy, func(context.Context) error { return nil }); err == nil {
+			t.Errorf("Do accepted %+v", policy)
+		}
+	}
+}
+
+func TestDoRejectsUnboundedPolicyWithoutBackoff(t *testing.T) {
+	calls := 0
+	if err := Do(context.Background(), RetryPolicy{}, func(context.Context) error {
+		calls++
+		return pgError("40001")
+	}); err == nil || calls != 0 {
+		t.Errorf("Do with neither limits nor backoff = %v after %d calls, want an error before calling", err, calls)
+	}
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RLSVar sets the custom setting key, e.g. "app.tenant_id", to value on every connection, as the default seen by row-level
+// security policies through current_setting(key). key must be qualified with a prefix, as PostgreSQL requires for custom settings.
+// Use WithTxVars to override it for one transaction.
+func WithRLSVar(key, value string) Option {
+	return func(options *options) error {
+		if err := checkCustomSetting(key); err != nil {
+			return err
+		}
+		options.setRuntimeParam(key, value)
+		return nil
+	}
+}
+
+// WithTxVars runs fn in a transaction like WithTx, with the custom settings vars, e.g. {"app.tenant_id": "42"}, set only for
+// that transaction, so they revert at commit or rollback and never leak to the next user of the connection. Values are sent
+// as parameters of set_config, so any value is safe.
+func (p *Pool) WithTxVars(ctx context.Context, vars map[string]string, fn func(tx *Tx) error) error {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		if err := checkCustomSetting(key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return p.WithTx(ctx, func(tx *Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", key, vars[key]); err != nil {
+				return fmt.Errorf("set %s: %w", key, err)
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func checkCustomSetting(key string) error {
+	prefix, name, ok := strings.Cut(key, ".")
+	if !ok || prefix == "" || name == "" {
+		return fmt.Errorf("custom setting %q must be of the form prefix.name", key)
+	}
+	return nil
+}
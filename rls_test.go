@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestCustomSettingValidate(t *testing.T) {
+	for _, key := range []string{"", "tenant_id", ".tenant_id", "app.", "."} {
+		if err := WithRLSVar(key, "1")(&options{}); err == nil {
+			t.Errorf("WithRLSVar accepted the key %q", key)
+		}
+		if err := (&Pool{}).WithTxVars(context.Background(), map[string]string{key: "1"}, func(*Tx) error { return nil }); err == nil {
+			t.Errorf("WithTxVars accepted the key %q", key)
+		}
+	}
+	var opt options
+	if err := WithRLSVar("app.tenant_id", "42")(&opt); err != nil || opt.runtimeparams["app.tenant_id"] != "42" {
+		t.Errorf("WithRLSVar set %q, %v, want app.tenant_id 42", opt.runtimeparams["app.tenant_id"], err)
+	}
+}
+
+func TestTxVarsIsolateTenants(t *testing.T) {
+	role := testName("test_tenant_role")
+	testObject(t, "CREATE ROLE "+role+" NOLOGIN", "DROP ROLE "+role)
+	testObject(t, "GRANT "+role+" TO CURRENT_USER", "REVOKE "+role+" FROM CURRENT_USER")
+	table := testTable(t, "test_tenant", "tenant_id int, note text")
+	p := testPool(t, WithMaxConns(2), WithRLSVar("app.tenant_id", "0"))
+	ctx := testContext(t)
+	for _, sql := range []string{
+		"INSERT INTO " + table + " VALUES (1, 'a'), (2, 'b'), (2, 'c')",
+		"ALTER TABLE " + table + " ENABLE ROW LEVEL SECURITY",
+		"CREATE POLICY tenant ON " + table + " USING (tenant_id = current_setting('app.tenant_id')::int)",
+		"GRANT SELECT ON " + table + " TO " + role,
+	} {
+		if _, err := p.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The table owner and superusers bypass the policy, so each transaction switches to the unprivileged role. Both set their
+	// tenant before either counts, so each count runs while the other tenant's transaction is open.
+	var set sync.WaitGroup
+	set.Add(2)
+	both := make(chan struct{})
+	go func() {
+		set.Wait()
+		close(both)
+	}()
+	want := map[string]int{"1": 1, "2": 2}
+	errs := make(chan error, len(want))
+	for tenant, rows := range want {
+		go func(tenant string, rows int) {
+			errs <- p.WithTxVars(ctx, map[string]string{"app.tenant_id": tenant}, func(tx *Tx) error {
+				if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+role); err != nil {
+					return err
+				}
+				set.Done()
+				select {
+				case <-both:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				n, err := Scalar[int](ctx, tx, "SELECT count(*) FROM "+table)
+				if err != nil {
+					return err
+				}
+				if n != rows {
+					t.Errorf("tenant %s sees %d rows, want %d", tenant, n, rows)
+				}
+				return nil
+			})
+		}(tenant, rows)
+	}
+	for range want {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tenant, err := Scalar[string](ctx, p, "SELECT current_setting('app.tenant_id')")
+	if err != nil || tenant != "0" {
+		t.Errorf("app.tenant_id after the transactions = %q, %v, want the pool default 0", tenant, err)
+	}
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+type queryNameKey struct{}
+
+// WithQueryName returns a context naming the queries run with it, e.g. "users.list". The name is reported by WithRowCounts.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// QueryName returns the name set by WithQueryName, or "" if there is none.
+func QueryName(ctx context.Context) string {
+	name, _ := ctx.Value(queryNameKey{}).(string)
+	return name
+}
+
+// RowCounts reports the number of rows returned by every successful query, or affected by every statement, taken from its command tag.
+// record, if not nil, is called with the query name (see WithQueryName) and the count, e.g. to feed a histogram; it must be fast and safe for concurrent use.
+// When a single statement exceeds threshold rows a warning is logged through the configured logger; a threshold of 0 disables the warning.
+func WithRowCounts(threshold int64, record func(ctx context.Context, name string, rows int64)) Option {
+	return func(options *options) error {
+		if threshold < 0 {
+			return fmt.Errorf("row count threshold cannot be less than zero")
+		}
+		tracer := &rowCountTracer{threshold: threshold, record: record}
+		options.tracers = append(options.tracers, func(string) pgx.QueryTracer {
+			return tracer
+		})
+		options.onnew = append(options.onnew, func(p *Pool) error {
+			tracer.pool.Store(p)
+			return nil
+		})
+		return nil
+	}
+}
+
+type rowCountTracer struct {
+	threshold int64
+	record    func(ctx context.Context, name string, rows int64)
+	pool      atomic.Pointer[Pool]
+}
+
+type rowCountQueryKey struct{}
+
+func (t *rowCountTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, rowCountQueryKey{}, data.SQL)
+}
+
+func (t *rowCountTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if data.Err != nil {
+		return
+	}
+	rows := data.CommandTag.RowsAffected()
+	name := QueryName(ctx)
+	if t.record != nil {
+		t.record(ctx, name, rows)
+	}
+	if t.threshold == 0 || rows <= t.threshold {
+		return
+	}
+	if p := t.pool.Load(); p != nil {
+		sql, _ := ctx.Value(rowCountQueryKey{}).(string)
+		p.log(ctx, tracelog.LogLevelWarn, "query row count over threshold", map[string]any{
+			"name":      name,
+			"sql":       sql,
+			"rows":      rows,
+			"threshold": t.threshold,
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const row_count_log = "query row count over threshold"
+
+func TestRowCountTracer(t *testing.T) {
+	var logs logRecorder
+	var recorded []int64
+	tracer := &rowCountTracer{threshold: 100, record: func(ctx context.Context, name string, rows int64) {
+		if name != "users.list" {
+			t.Errorf("recorded the name %q, want users.list", name)
+		}
+		recorded = append(recorded, rows)
+	}}
+	tracer.pool.Store(unreachablePool(t, &logs))
+	ctx := WithQueryName(context.Background(), "users.list")
+	run := func(sql, tag string, err error) {
+		ctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag(tag), Err: err})
+	}
+	run("SELECT * FROM users LIMIT 100", "SELECT 100", nil)
+	run("SELECT * FROM users", "SELECT 5000", nil)
+	run("SELECT * FROM broken", "", errRecorded)
+	if len(recorded) != 2 || recorded[0] != 100 || recorded[1] != 5000 {
+		t.Errorf("recorded %v, want 100 and 5000 and nothing for the failed query", recorded)
+	}
+	warnings := logs.find(row_count_log)
+	if len(warnings) != 1 {
+		t.Fatalf("%d warnings, want 1 for the query over the threshold", len(warnings))
+	}
+	data := warnings[0].data
+	if data["sql"] != "SELECT * FROM users" || data["rows"] != int64(5000) || data["name"] != "users.list" || data["threshold"] != int64(100) {
+		t.Errorf("warning data = %v", data)
+	}
+}
+
+func TestRowCountsValidate(t *testing.T) {
+	if err := WithRowCounts(-1, nil)(&options{}); err == nil {
+		t.Error("WithRowCounts accepted a negative threshold")
+	}
+}
+
+func TestRowCountsLargeResult(t *testing.T) {
+	core, observed := observer.New(zapcore.WarnLevel)
+	var mu sync.Mutex
+	counts := map[string]int64{}
+	p := testPool(t, WithZapLogger(zap.New(core), "warn"), WithRowCounts(1000, func(_ context.Context, name string, rows int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[name] = rows
+	}))
+	ctx := WithQueryName(testContext(t), "series")
+	if _, err := p.Exec(ctx, "SELECT generate_series(1, 5000)"); err != nil {
+		t.Fatal(err)
+	}
+	entries := observed.FilterMessage(row_count_log).All()
+	if len(entries) != 1 || entries[0].ContextMap()["rows"] != int64(5000) {
+		t.Errorf("logged %d row count warnings, want one for 5000 rows", len(entries))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if counts["series"] != 5000 {
+		t.Errorf("recorded %d rows for series, want 5000", counts["series"])
+	}
+}
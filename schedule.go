@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// Schedule runs fn every interval until the pool is closed. The context passed to fn is cancelled by Close, which waits for a running fn
+// to return. Errors returned by fn are logged through the configured logger and do not stop the schedule.
+func (p *Pool) Schedule(interval time.Duration, fn func(ctx context.Context) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("schedule interval must be greater than zero")
+	}
+	started := p.goBackground(func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				p.log(ctx, tracelog.LogLevelError, "scheduled task", map[string]any{"err": err})
+			}
+		}
+	})
+	if !started {
+		return fmt.Errorf("pool is closed")
+	}
+	return nil
+}
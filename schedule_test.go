@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduleRunsUntilClose(t *testing.T) {
+	var logs logRecorder
+	p := unreachablePool(t, &logs)
+	if err := p.Schedule(0, func(context.Context) error { return nil }); err == nil {
+		t.Error("Schedule accepted a zero interval")
+	}
+	var runs atomic.Int32
+	if err := p.Schedule(10*time.Millisecond, func(context.Context) error {
+		if runs.Add(1)%2 == 0 {
+			return errors.New("task failed")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() < 4 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if runs.Load() < 4 {
+		t.Fatalf("task ran %d times, want it every 10ms", runs.Load())
+	}
+	if logs.count("scheduled task") == 0 {
+		t.Error("the failed runs were not logged")
+	}
+	p.Close()
+	// Close waits for a running task, so none runs from here on.
+	after := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := runs.Load(); n != after {
+		t.Errorf("task ran %d more times after Close", n-after)
+	}
+	if err := p.Schedule(time.Millisecond, func(context.Context) error { return nil }); err == nil {
+		t.Error("Schedule succeeded on a closed pool")
+	}
+}
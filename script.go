@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ExecScript runs a multi-statement SQL script, e.g. the contents of a .sql file, one statement at a time with the simple protocol.
+// Statements are split on semicolons outside of string literals, quoted identifiers, comments, dollar-quoted bodies and
+// SQL-standard BEGIN ATOMIC ... END bodies, so function definitions are kept whole. On error ExecScript stops and reports the failing statement's number and first line.
+// Statements are not wrapped in a transaction; begin one in the script or pass a *Tx as db to make the script atomic.
+// Each statement is rewritten and tagged like those of the other helpers.
+func ExecScript(ctx context.Context, db Querier, script string) error {
+	cfg := configOf(db)
+	for i, statement := range splitStatements(script) {
+		// The statements always use the simple protocol, so a mode set with WithQueryMode is dropped.
+		sql, _ := cfg.prepare(ctx, statement.sql, nil)
+		if _, err := db.Exec(ctx, sql, pgx.QueryExecModeSimpleProtocol); err != nil {
+			return fmt.Errorf("statement %d at line %d: %w", i+1, statement.line, err)
+		}
+	}
+	return nil
+}
+
+type scriptStatement struct {
+	sql  string
+	line int // line of the script the statement starts on
+}
+
+// splitStatements splits script into its statements, dropping empty ones.
+func splitStatements(script string) []scriptStatement {
+	var statements []scriptStatement
+	start, line, startLine := 0, 1, 1
+	// atomic counts the open BEGIN ATOMIC bodies and the CASE expressions inside them, each closed by an END.
+	atomic, prev := 0, ""
+	flush := func(end int) {
+		sql := script[start:end]
+		if trimmed := strings.TrimSpace(sql); trimmed != "" {
+			offset := strings.Count(sql[:strings.Index(sql, trimmed)], "\n")
+			statements = append(statements, scriptStatement{sql: trimmed, line: startLine + offset})
+		}
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == ';':
+			if atomic > 0 {
+				continue
+			}
+			flush(i)
+			start, startLine, prev = i+1, line, ""
+		case c == '\'' || c == '"':
+			escapes := c == '\'' && i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') && (i == 1 || !isIdentChar(script[i-2]))
+			i = skipQuoted(script, i, c, escapes, &line)
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			depth := 0
+			for ; i < len(script); i++ {
+				switch {
+				case script[i] == '\n':
+					line++
+				case strings.HasPrefix(script[i:], "/*"):
+					depth++
+					i++
+				case strings.HasPrefix(script[i:], "*/"):
+					depth--
+					i++
+				}
+				if depth == 0 {
+					break
+				}
+			}
+		case c == '$' && (i == 0 || !isIdentChar(script[i-1])):
+			tag, ok := dollarTag(script[i:])
+			if !ok {
+				continue
+			}
+			body := i + len(tag)
+			end := strings.Index(script[body:], tag)
+			if end < 0 {
+				end = len(script) - body
+			} else {
+				end += len(tag)
+			}
+			line += strings.Count(script[i:body+end], "\n")
+			i = body + end - 1
+		case (c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') && (i == 0 || !isIdentChar(script[i-1])):
+			end := i + 1
+			for end < len(script) && isIdentChar(script[end]) {
+				end++
+			}
+			word := strings.ToUpper(script[i:end])
+			switch {
+			case word == "ATOMIC" && prev == "BEGIN", word == "CASE" && atomic > 0:
+				atomic++
+			case word == "END" && atomic > 0:
+				atomic--
+			}
+			prev, i = word, end-1
+		}
+	}
+	flush(len(script))
+	return statements
+}
+
+// skipQuoted returns the index of the quote closing the literal or identifier opened at script[open]. A doubled quote is part of
+// the literal, as is a backslash-escaped character in an E'...' string.
+func skipQuoted(script string, open int, quote byte, escapes bool, line *int) int {
+	for i := open + 1; i < len(script); i++ {
+		switch script[i] {
+		case '\n':
+			*line++
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(script) && script[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(script)
+}
+
+// dollarTag returns the opening tag, e.g. "$$" or "$body$", at the start of s.
+func dollarTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1], true
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || i > 1 && c >= '0' && c <= '9':
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		script string
+		want   []scriptStatement
+	}{
+		{
+			name:   "plain",
+			script: "CREATE TABLE t (id int);\n\nINSERT INTO t VALUES (1);\n  ;\nSELECT 1",
+			want: []scriptStatement{
+				{sql: "CREATE TABLE t (id int)", line: 1},
+				{sql: "INSERT INTO t VALUES (1)", line: 3},
+				{sql: "SELECT 1", line: 5},
+			},
+		},
+		{
+			name:   "quoted",
+			script: "SELECT 'a;''b'; SELECT \"x;\"\"y\" FROM t;",
+			want: []scriptStatement{
+				{sql: "SELECT 'a;''b'", line: 1},
+				{sql: "SELECT \"x;\"\"y\" FROM t", line: 1},
+			},
+		},
+		{
+			name:   "escape string",
+			script: "SELECT E'it\\'s;\\n';\nSELECT e'\\\\';\nSELECT note'x;'",
+			want: []scriptStatement{
+				{sql: "SELECT E'it\\'s;\\n'", line: 1},
+				{sql: "SELECT e'\\\\'", line: 2},
+				{sql: "SELECT note'x;'", line: 3},
+			},
+		},
+		{
+			name:   "comments",
+			script: "-- header; still a comment\nSELECT 1; /* a; /* nested; */ b; */\nSELECT 2;",
+			want: []scriptStatement{
+				{sql: "-- header; still a comment\nSELECT 1", line: 1},
+				{sql: "/* a; /* nested; */ b; */\nSELECT 2", line: 2},
+			},
+		},
+		{
+			name: "dollar quoted function",
+			script: "CREATE FUNCTION f() RETURNS int LANGUAGE plpgsql AS $body$\nBEGIN\n  RETURN 1; -- $$ inside\nEND;\n$body$;\n" +
+				"SELECT $1, $$a;b$$;",
+			want: []scriptStatement{
+				{sql: "CREATE FUNCTION f() RETURNS int LANGUAGE plpgsql AS $body$\nBEGIN\n  RETURN 1; -- $$ inside\nEND;\n$body$", line: 1},
+				{sql: "SELECT $1, $$a;b$$", line: 6},
+			},
+		},
+		{
+			name: "begin atomic",
+			script: "CREATE FUNCTION g(x int) RETURNS text LANGUAGE sql\nBEGIN ATOMIC\n  INSERT INTO t VALUES (x);\n" +
+				"  SELECT CASE WHEN x > 0 THEN 'pos;' ELSE 'neg' END;\nend;\nBEGIN;\nCOMMIT;",
+			want: []scriptStatement{
+				{sql: "CREATE FUNCTION g(x int) RETURNS text LANGUAGE sql\nBEGIN ATOMIC\n  INSERT INTO t VALUES (x);\n" +
+					"  SELECT CASE WHEN x > 0 THEN 'pos;' ELSE 'neg' END;\nend", line: 1},
+				{sql: "BEGIN", line: 6},
+				{sql: "COMMIT", line: 7},
+			},
+		},
+		{
+			name:   "case outside atomic",
+			script: "SELECT CASE WHEN true THEN 1 END; SELECT 2",
+			want: []scriptStatement{
+				{sql: "SELECT CASE WHEN true THEN 1 END", line: 1},
+				{sql: "SELECT 2", line: 1},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	table := testName("script")
+	function := testName("script_fn")
+	t.Cleanup(func() {
+		_, _ = p.Exec(testContext(t), "DROP FUNCTION IF EXISTS "+function+"(int)")
+		_, _ = p.Exec(testContext(t), "DROP TABLE IF EXISTS "+table)
+	})
+	script := strings.NewReplacer("$table", table, "$function", function).Replace(`
+CREATE TABLE $table (id int, note text);
+INSERT INTO $table VALUES (1, 'one;');
+CREATE FUNCTION $function(x int) RETURNS int LANGUAGE plpgsql AS $$
+BEGIN
+	INSERT INTO $table VALUES (x, 'plpgsql');
+	RETURN x;
+END;
+$$;
+SELECT $function(2);
+`)
+	if err := ExecScript(ctx, p, script); err != nil {
+		t.Fatal(err)
+	}
+	n, err := Scalar[int](ctx, p, "SELECT count(*) FROM "+table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("%s has %d rows, want 2", table, n)
+	}
+	err = ExecScript(ctx, p, "SELECT 1;\n\nSELECT * FROM "+table+"_missing;")
+	if err == nil || !strings.Contains(err.Error(), "statement 2 at line 3") {
+		t.Errorf("ExecScript error = %v, want it to name statement 2 at line 3", err)
+	}
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// Session is a connection held for the duration of Pool.Session. It implements Querier, so the package helpers can be used with it.
+type Session struct {
+	*pgxpool.Conn
+	cfg *helperConfig
+}
+
+func (s *Session) helpers() *helperConfig {
+	return s.cfg
+}
+
+// BackendPID returns the server process ID serving the session, as logged by PostgreSQL with %p in log_line_prefix.
+func (s *Session) BackendPID() int32 {
+	return BackendPID(s.Conn)
+}
+
+// Session acquires a connection, runs fn with it and releases the connection when fn returns.
+// Every statement run through s uses the same connection, so temporary tables and session settings are visible between them.
+// Session settings are not reset on release and are seen by the next user of the connection.
+func (p *Pool) Session(ctx context.Context, fn func(s *Session) error) error {
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return fn(&Session{Conn: conn, cfg: p.cfg})
+}
+
+type readFallback struct {
+	replica *Pool
+	timeout time.Duration
+}
+
+// ReadFallback lets ReadSession use a connection of replica when none can be acquired from this pool within timeout, e.g. because
+// it is saturated. It only applies to ReadSession, which must only be used for reads; the replica may lag behind this pool and
+// rejects writes. Pool.Session and the other methods never fall back.
+func WithReadFallback(replica *Pool, timeout time.Duration) Option {
+	return func(options *options) error {
+		if replica == nil {
+			return fmt.Errorf("read fallback replica cannot be nil")
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("read fallback timeout must be greater than zero")
+		}
+		options.readfallback = &readFallback{replica: replica, timeout: timeout}
+		return nil
+	}
+}
+
+// ReadSession is Session for read-only work: with WithReadFallback, fn runs on a replica connection when this pool has none
+// available in time. fn must not write, and must tolerate data slightly behind the primary.
+func (p *Pool) ReadSession(ctx context.Context, fn func(s *Session) error) error {
+	if p.readFallback == nil {
+		return p.Session(ctx, fn)
+	}
+	acquireCtx, cancel := context.WithTimeout(ctx, p.readFallback.timeout)
+	conn, err := p.Acquire(acquireCtx)
+	timedOut := acquireCtx.Err() != nil && ctx.Err() == nil
+	cancel()
+	if err != nil && !timedOut {
+		return err
+	}
+	if err != nil {
+		p.log(ctx, tracelog.LogLevelDebug, "acquire timed out, reading from replica", map[string]any{"timeout": p.readFallback.timeout})
+		return p.readFallback.replica.Session(ctx, fn)
+	}
+	defer conn.Release()
+	return fn(&Session{Conn: conn, cfg: p.cfg})
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadSessionFallback(t *testing.T) {
+	primaryServer, replicaServer := newAcceptingServer(t), newAcceptingServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	replica, err := New(ctx, WithHost("127.0.0.1"), WithPort(replicaServer.port), WithSSLMode("disable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	primary, err := New(ctx, WithHost("127.0.0.1"), WithPort(primaryServer.port), WithSSLMode("disable"), WithMaxConns(1),
+		WithReadFallback(replica, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+	port := func() uint16 {
+		var got uint16
+		if err := primary.ReadSession(ctx, func(s *Session) error {
+			got = s.Conn.Conn().Config().Port
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := port(); got != uint16(primaryServer.port) {
+		t.Errorf("ReadSession on an idle primary used port %d, want the primary's %d", got, primaryServer.port)
+	}
+	held, err := primary.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if got := port(); got != uint16(replicaServer.port) {
+		t.Errorf("ReadSession on a saturated primary used port %d, want the replica's %d", got, replicaServer.port)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("ReadSession fell back after %s, before the 50ms acquire timeout", elapsed)
+	}
+	held.Release()
+	cancelled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	if err := primary.ReadSession(cancelled, func(*Session) error { return nil }); err == nil {
+		t.Error("ReadSession with a cancelled context succeeded, want the acquire error")
+	}
+}
+
+func TestSessionTempTable(t *testing.T) {
+	p := testPool(t, WithMaxConns(2))
+	ctx := testContext(t)
+	err := p.Session(ctx, func(s *Session) error {
+		if _, err := s.Exec(ctx, "CREATE TEMP TABLE session_scratch (id int8, note text)"); err != nil {
+			return err
+		}
+		if _, err := s.Exec(ctx, "INSERT INTO session_scratch VALUES (1, 'a'), (2, 'b')"); err != nil {
+			return err
+		}
+		n, err := Count(ctx, s, "session_scratch", "")
+		if err != nil {
+			return err
+		}
+		if n != 2 {
+			t.Errorf("temp table has %d rows in the session, want 2", n)
+		}
+		// The pool's other connection does not see the table, which is why the statements must share the session.
+		other, err := p.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer other.Release()
+		if _, err := other.Exec(ctx, "SELECT 1 FROM session_scratch"); err == nil {
+			t.Error("temp table is visible on another connection")
+		}
+		_, err = s.Exec(ctx, "DROP TABLE session_scratch")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionAndTxBackendPID(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	if err := p.Session(ctx, func(s *Session) error {
+		if pid := s.BackendPID(); pid != fake_server_pid {
+			t.Errorf("Session.BackendPID = %d, want %d", pid, fake_server_pid)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WithTx(ctx, func(tx *Tx) error {
+		if pid := tx.BackendPID(); pid != fake_server_pid {
+			t.Errorf("Tx.BackendPID = %d, want %d", pid, fake_server_pid)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionAndTxBackendPIDOnServer(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	err := p.Session(ctx, func(s *Session) error {
+		pid, err := Scalar[int32](ctx, s, "SELECT pg_backend_pid()")
+		if err != nil {
+			return err
+		}
+		if s.BackendPID() == 0 || s.BackendPID() != pid {
+			t.Errorf("Session.BackendPID = %d, want pg_backend_pid() %d", s.BackendPID(), pid)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.WithTx(ctx, func(tx *Tx) error {
+		pid, err := Scalar[int32](ctx, tx, "SELECT pg_backend_pid()")
+		if err != nil {
+			return err
+		}
+		if tx.BackendPID() == 0 || tx.BackendPID() != pid {
+			t.Errorf("Tx.BackendPID = %d, want pg_backend_pid() %d", tx.BackendPID(), pid)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
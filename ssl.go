@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// Connects with sslmode=require and, when the server refuses TLS, retries the same host without it, logging a warning for every such
+// connection through the configured logger. A TLS attempt failing otherwise, e.g. on a timeout or reset, is not retried without TLS. Overrides an earlier WithSSLMode, a later one disables the fallback again. The server certificate is not verified, as with sslmode=require.
+func WithSSLPreferWithFallback() Option {
+	return func(options *options) error {
+		mode := "require"
+		options.sslmode = &mode
+		options.sslfallback = true
+		return nil
+	}
+}
+
+// applySSLFallback adds a plaintext attempt after every TLS attempt of cfg and the warning for connections made without TLS.
+// pgconn moves on to the next attempt whatever the error, so the dialer lets a plaintext attempt through only to a server that
+// refused TLS: a TLS attempt failing otherwise, e.g. on a timeout or a reset, does not downgrade the connection. It must run after
+// applyDialer and before applyHooks.
+func applySSLFallback(cfg *pgxpool.Config, opt *options, tl *levelTracer) {
+	if !opt.sslfallback {
+		return
+	}
+	conn := &cfg.ConnConfig.Config
+	fallbacks := make([]*pgconn.FallbackConfig, 0, 2*len(conn.Fallbacks)+1)
+	if conn.TLSConfig != nil {
+		fallbacks = append(fallbacks, &pgconn.FallbackConfig{Host: conn.Host, Port: conn.Port})
+	}
+	for _, fallback := range conn.Fallbacks {
+		fallbacks = append(fallbacks, fallback)
+		if fallback.TLSConfig != nil {
+			fallbacks = append(fallbacks, &pgconn.FallbackConfig{Host: fallback.Host, Port: fallback.Port})
+		}
+	}
+	if len(fallbacks) == len(conn.Fallbacks) {
+		// no attempt uses TLS, so there is nothing to fall back from
+		return
+	}
+	conn.Fallbacks = fallbacks
+	refusals := &tlsRefusals{addrs: make(map[string]bool)}
+	dial := conn.DialFunc
+	conn.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &fallbackConn{Conn: c, addr: addr, refusals: refusals}, nil
+	}
+	opt.afterconnect = append(opt.afterconnect, func(ctx context.Context, c *pgx.Conn) error {
+		if _, ok := c.PgConn().Conn().(*tls.Conn); !ok && tl != nil {
+			tl.Log(ctx, tracelog.LogLevelWarn, "server refused TLS, connected without it", map[string]any{
+				"addr": c.PgConn().Conn().RemoteAddr().String(),
+			})
+		}
+		return nil
+	})
+}
+
+// errNoTLSRefusal fails a plaintext attempt to a server that has not refused TLS.
+var errNoTLSRefusal = errors.New("server has not refused TLS, not connecting without it")
+
+// tlsRefusals holds the addresses whose server answered the last SSLRequest sent to it with a refusal.
+type tlsRefusals struct {
+	mu    sync.Mutex
+	addrs map[string]bool
+}
+
+func (r *tlsRefusals) set(addr string, refused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs[addr] = refused
+}
+
+func (r *tlsRefusals) refused(addr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs[addr]
+}
+
+// sslRequest is the message asking the server for TLS.
+var sslRequest = []byte{0, 0, 0, 8, 4, 210, 22, 47}
+
+// fallbackConn records the server's answer when the first message sent is an SSLRequest, and otherwise, the connection being a
+// plaintext attempt, fails that message unless the server refused TLS.
+type fallbackConn struct {
+	net.Conn
+	addr     string
+	refusals *tlsRefusals
+	written  atomic.Bool // the first message was written
+	asked    atomic.Bool // the first message was an SSLRequest whose answer was not read yet
+}
+
+func (c *fallbackConn) Write(b []byte) (int, error) {
+	if !c.written.Swap(true) {
+		if bytes.Equal(b, sslRequest) {
+			c.asked.Store(true)
+		} else if !c.refusals.refused(c.addr) {
+			return 0, errNoTLSRefusal
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *fallbackConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.asked.Swap(false) {
+		c.refusals.set(c.addr, b[0] == 'N')
+	}
+	return n, err
+}
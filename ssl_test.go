@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const ssl_fallback_log = "server refused TLS, connected without it"
+
+func TestSSLPreferWithFallback(t *testing.T) {
+	server := newAcceptingServer(t)
+	core, observed := observer.New(zapcore.WarnLevel)
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLPreferWithFallback(),
+		WithZapLogger(zap.New(core), "warn"))
+	if err != nil {
+		t.Fatalf("New against a server without TLS: %v", err)
+	}
+	defer p.Close()
+	if n := server.tls.Load(); n == 0 {
+		t.Error("the pool did not ask for TLS first")
+	}
+	entries := observed.FilterMessage(ssl_fallback_log).All()
+	if len(entries) == 0 {
+		t.Fatal("no warning for the connection made without TLS")
+	}
+	if addr, _ := entries[0].ContextMap()["addr"].(string); addr == "" {
+		t.Errorf("warning fields = %v, want the server address", entries[0].ContextMap())
+	}
+}
+
+func TestSSLModeDisablesFallback(t *testing.T) {
+	server := newAcceptingServer(t)
+	core, observed := observer.New(zapcore.WarnLevel)
+	p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLPreferWithFallback(),
+		WithSSLMode("require"), WithZapLogger(zap.New(core), "warn"))
+	if err == nil {
+		p.Close()
+		t.Fatal("New with sslmode=require connected to a server without TLS")
+	}
+	if n := observed.FilterMessage(ssl_fallback_log).Len(); n != 0 {
+		t.Errorf("%d fallback warnings after a later WithSSLMode, want 0", n)
+	}
+}
+
+// A TLS attempt failing for any reason but the server's refusal must not be retried in plaintext. pgconn already gives up on a host
+// whose connect timeout expired, the dialer stops the retry after a reset.
+func TestSSLFallbackOnlyAfterRefusal(t *testing.T) {
+	for name, failure := range map[string]func(*fakeServer){
+		"timeout": func(s *fakeServer) { s.stallTLS.Store(true) },
+		"reset":   func(s *fakeServer) { s.dropTLS.Store(true) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newAcceptingServer(t)
+			failure(server)
+			core, observed := observer.New(zapcore.WarnLevel)
+			p, err := New(context.Background(), WithHost("127.0.0.1"), WithPort(server.port), WithSSLPreferWithFallback(),
+				WithConnectTimeout(200*time.Millisecond), WithZapLogger(zap.New(core), "warn"))
+			if err == nil {
+				p.Close()
+				t.Fatal("New connected without TLS after the TLS attempt failed")
+			}
+			if n := server.tls.Load(); n == 0 {
+				t.Error("the pool did not ask for TLS")
+			}
+			select {
+			case login := <-server.startups:
+				t.Errorf("server received a plaintext login %v after the TLS attempt failed", login.params)
+			default:
+			}
+			if n := observed.FilterMessage(ssl_fallback_log).Len(); n != 0 {
+				t.Errorf("%d fallback warnings, want 0", n)
+			}
+		})
+	}
+}
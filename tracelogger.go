@@ -1,9 +1,15 @@
 package postgres
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
 	logrus_adapter "github.com/jackc/pgx-logrus"
 	zap_adapter "github.com/jackc/pgx-zap"
 	zero_adapter "github.com/jackc/pgx-zerolog"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/tracelog"
 	"github.com/rs/zerolog"
 	"github.com/sirupsen/logrus"
@@ -60,3 +66,135 @@ func WithLogrusLogger(log logrus.FieldLogger, level string) Option {
 		return nil
 	}
 }
+
+// Logs the effective pool configuration once in New. The password is never logged. Requires one of the loggers above.
+func WithConfigLogging() Option {
+	return func(options *options) error {
+		options.configlogging = true
+		return nil
+	}
+}
+
+func logConfig(ctx context.Context, tl *tracelog.TraceLog, cfg *pgxpool.Config) {
+	if tl.LogLevel < tracelog.LogLevelInfo {
+		return
+	}
+	tl.Logger.Log(ctx, tracelog.LogLevelInfo, "postgres config", map[string]any{
+		"host":                     cfg.ConnConfig.Host,
+		"port":                     cfg.ConnConfig.Port,
+		"database":                 cfg.ConnConfig.Database,
+		"user":                     cfg.ConnConfig.User,
+		"max_conns":                cfg.MaxConns,
+		"min_conns":                cfg.MinConns,
+		"max_conn_lifetime":        cfg.MaxConnLifetime,
+		"max_conn_idle_time":       cfg.MaxConnIdleTime,
+		"health_check_period":      cfg.HealthCheckPeriod,
+		"max_conn_lifetime_jitter": cfg.MaxConnLifetimeJitter,
+		"connect_timeout":          cfg.ConnConfig.ConnectTimeout,
+	})
+}
+
+type namedLogger struct {
+	name   string
+	logger tracelog.Logger
+}
+
+func (l *namedLogger) Log(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+	if data == nil {
+		data = make(map[string]any, 1)
+	}
+	data["pool"] = l.name
+	l.logger.Log(ctx, level, msg, data)
+}
+
+// levelTracer traces through the TraceLog of the current level. SetLogLevel swaps in a TraceLog with the new level while
+// the pool is in use, since the level of a TraceLog cannot be changed safely once connections use it. It also logs the
+// entries of the package itself at the current level.
+type levelTracer struct {
+	tl atomic.Pointer[tracelog.TraceLog]
+}
+
+func newLevelTracer(tl *tracelog.TraceLog) *levelTracer {
+	if tl.Config == nil {
+		tl.Config = tracelog.DefaultTraceLogConfig()
+	}
+	t := &levelTracer{}
+	t.tl.Store(tl)
+	return t
+}
+
+func (t *levelTracer) setLevel(level tracelog.LogLevel) {
+	tl := t.tl.Load()
+	t.tl.Store(&tracelog.TraceLog{Logger: tl.Logger, LogLevel: level, Config: tl.Config})
+}
+
+func (t *levelTracer) Log(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+	if tl := t.tl.Load(); tl.LogLevel >= level {
+		tl.Logger.Log(ctx, level, msg, data)
+	}
+}
+
+func (t *levelTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return t.tl.Load().TraceQueryStart(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.tl.Load().TraceQueryEnd(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return t.tl.Load().TraceBatchStart(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	t.tl.Load().TraceBatchQuery(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.tl.Load().TraceBatchEnd(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.tl.Load().TraceCopyFromStart(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.tl.Load().TraceCopyFromEnd(ctx, conn, data)
+}
+
+func (t *levelTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	return t.tl.Load().TraceConnectStart(ctx, data)
+}
+
+func (t *levelTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	t.tl.Load().TraceConnectEnd(ctx, data)
+}
+
+func (t *levelTracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	return t.tl.Load().TracePrepareStart(ctx, conn, data)
+}
+
+func (t *levelTracer) TracePrepareEnd(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareEndData) {
+	t.tl.Load().TracePrepareEnd(ctx, conn, data)
+}
+
+// SetLogLevel changes the level of the configured logger, e.g. to "debug" to see every query while debugging, without recreating
+// the pool. It applies to queries started afterwards. It fails if level is invalid or no logger is configured.
+func (p *Pool) SetLogLevel(level string) error {
+	lvl, err := tracelog.LogLevelFromString(level)
+	if err != nil {
+		return err
+	}
+	if p.tl == nil {
+		return fmt.Errorf("no logger configured")
+	}
+	p.tl.setLevel(lvl)
+	return nil
+}
+
+// log writes to the configured logger, if any, honouring its level.
+func (p *Pool) log(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+	if p.tl != nil {
+		p.tl.Log(ctx, level, msg, data)
+	}
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Creates an "acquire" span for every connection acquire and an "execute" span for every query, both as children of the caller's span
+// and carrying the pool name set with WithName. Comparing the two shows whether latency comes from pool contention or from the query itself.
+// It is combined with the other tracers such as the loggers.
+func WithTracing(tracer trace.Tracer) Option {
+	return func(options *options) error {
+		if tracer == nil {
+			return fmt.Errorf("tracer cannot be nil")
+		}
+		options.tracers = append(options.tracers, func(name string) pgx.QueryTracer {
+			t := &spanTracer{tracer: tracer}
+			if name != "" {
+				t.attrs = []attribute.KeyValue{attribute.String("pool", name)}
+			}
+			return t
+		})
+		return nil
+	}
+}
+
+type spanTracer struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+func (t *spanTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "acquire", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(t.attrs...))
+	return ctx
+}
+
+func (t *spanTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+}
+
+func (t *spanTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	attrs := append([]attribute.KeyValue{attribute.String("db.statement", data.SQL)}, t.attrs...)
+	ctx, _ = t.tracer.Start(ctx, "execute", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx
+}
+
+func (t *spanTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer is a trace.Tracer keeping every span it starts.
+type recordingTracer struct {
+	noop.Tracer
+	spans []*recordingSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	span := &recordingSpan{name: name, kind: cfg.SpanKind(), attrs: cfg.Attributes(), parent: trace.SpanFromContext(ctx)}
+	r.spans = append(r.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordingSpan struct {
+	noop.Span
+	name   string
+	kind   trace.SpanKind
+	attrs  []attribute.KeyValue
+	parent trace.Span
+	err    error
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) { s.err = err }
+func (s *recordingSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *recordingSpan) End(...trace.SpanEndOption)                    { s.ended = true }
+
+func (s *recordingSpan) attr(key string) string {
+	for _, kv := range s.attrs {
+		if string(kv.Key) == key {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestTracingSpans(t *testing.T) {
+	if err := WithTracing(nil)(&options{}); err == nil {
+		t.Error("WithTracing accepted a nil tracer")
+	}
+	tracer := &recordingTracer{}
+	var opt options
+	if err := WithTracing(tracer)(&opt); err != nil {
+		t.Fatal(err)
+	}
+	st := opt.tracers[0]("orders").(*spanTracer)
+	parent := &recordingSpan{name: "handler"}
+	ctx := trace.ContextWithSpan(context.Background(), parent)
+
+	acquireCtx := st.TraceAcquireStart(ctx, nil, pgxpool.TraceAcquireStartData{})
+	st.TraceAcquireEnd(acquireCtx, nil, pgxpool.TraceAcquireEndData{})
+	failed := errors.New("syntax error")
+	queryCtx := st.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELEC 1"})
+	st.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: failed})
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("started %d spans, want 2", len(tracer.spans))
+	}
+	acquire, execute := tracer.spans[0], tracer.spans[1]
+	for _, span := range tracer.spans {
+		if span.parent != parent || span.kind != trace.SpanKindClient || !span.ended || span.attr("pool") != "orders" {
+			t.Errorf("%s span: parent %v, kind %v, ended %v, pool %q", span.name, span.parent, span.kind, span.ended, span.attr("pool"))
+		}
+	}
+	if acquire.name != "acquire" || acquire.err != nil || acquire.status != codes.Unset {
+		t.Errorf("acquire span = %+v", acquire)
+	}
+	if execute.name != "execute" || execute.attr("db.statement") != "SELEC 1" {
+		t.Errorf("execute span %q has statement %q", execute.name, execute.attr("db.statement"))
+	}
+	if execute.err != failed || execute.status != codes.Error {
+		t.Errorf("failed query span has error %v and status %v", execute.err, execute.status)
+	}
+}
+
+func TestTracingWithoutName(t *testing.T) {
+	var opt options
+	if err := WithTracing(&recordingTracer{})(&opt); err != nil {
+		t.Fatal(err)
+	}
+	if st := opt.tracers[0]("").(*spanTracer); len(st.attrs) != 0 {
+		t.Errorf("unnamed pool spans carry %v", st.attrs)
+	}
+}
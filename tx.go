@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tx is a transaction started by the WithTx helpers. It implements Querier, so the package helpers can be used inside the transaction.
+type Tx struct {
+	pgx.Tx
+	cfg *helperConfig
+}
+
+func (tx *Tx) helpers() *helperConfig {
+	return tx.cfg
+}
+
+// BackendPID returns the server process ID running the transaction.
+func (tx *Tx) BackendPID() int32 {
+	return int32(tx.Conn().PgConn().PID())
+}
+
+// WithTx runs fn in a transaction. The transaction is committed if fn returns nil and rolled back otherwise.
+// With WithTxRetries the whole transaction, including fn, is rerun when it fails with an error accepted by the retry predicate.
+func (p *Pool) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	return p.withTx(ctx, pgx.TxOptions{}, fn)
+}
+
+// WithTxOptions is WithTx starting the transaction with txOptions, e.g. a specific isolation level or access mode.
+func (p *Pool) WithTxOptions(ctx context.Context, txOptions pgx.TxOptions, fn func(tx *Tx) error) error {
+	return p.withTx(ctx, txOptions, fn)
+}
+
+// WithDeferrableReadOnlyTx runs fn in a SERIALIZABLE READ ONLY DEFERRABLE transaction. Such a transaction may wait when it starts
+// until it can take a snapshot that is safe from serialization conflicts, and then runs without the overhead of serializable checks
+// and can never fail with a serialization error. Use it for long reports that need a consistent view.
+func (p *Pool) WithDeferrableReadOnlyTx(ctx context.Context, fn func(tx *Tx) error) error {
+	return p.withTx(ctx, pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		AccessMode:     pgx.ReadOnly,
+		DeferrableMode: pgx.Deferrable,
+	}, fn)
+}
+
+// WithTxSearchPath runs fn in a transaction whose search_path is set to schema with SET LOCAL, so it reverts at commit or rollback.
+func (p *Pool) WithTxSearchPath(ctx context.Context, schema string, fn func(tx *Tx) error) error {
+	quoted, err := quoteIdent(schema)
+	if err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	return p.withTx(ctx, pgx.TxOptions{}, func(tx *Tx) error {
+		if _, err := tx.Exec(ctx, "SET LOCAL search_path TO "+quoted); err != nil {
+			return fmt.Errorf("set search_path: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+// WithBudget runs fn in a transaction that must complete within d. ctx is given a deadline d from now, and statement_timeout is set
+// for the transaction to the time left when it starts, so the server stops working on a statement when the client stops waiting for it.
+// The budget covers the whole transaction, including retries from WithTxRetries; statements run outside tx are only bound by the deadline.
+func (p *Pool) WithBudget(ctx context.Context, d time.Duration, fn func(tx *Tx) error) error {
+	if d < time.Millisecond {
+		return fmt.Errorf("budget cannot be less than 1ms")
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	return p.withTx(ctx, pgx.TxOptions{}, func(tx *Tx) error {
+		left := time.Until(deadline).Milliseconds()
+		if left <= 0 {
+			return context.DeadlineExceeded
+		}
+		if _, err := tx.Exec(ctx, "SELECT set_config('statement_timeout', $1, true)", strconv.FormatInt(left, 10)); err != nil {
+			return fmt.Errorf("set statement_timeout: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+func (p *Pool) withTx(ctx context.Context, txOptions pgx.TxOptions, fn func(tx *Tx) error) (err error) {
+	if p.recorder != nil {
+		start := time.Now()
+		defer func() {
+			p.recorder.RecordTx(ctx, QueryName(ctx), time.Since(start), err)
+		}()
+	}
+	for attempt := 0; ; attempt++ {
+		err := pgx.BeginTxFunc(ctx, p, txOptions, func(tx pgx.Tx) error {
+			return fn(&Tx{Tx: tx, cfg: p.cfg})
+		})
+		if err == nil || attempt >= p.cfg.txRetries || ctx.Err() != nil || !p.cfg.retryable(err) {
+			return wrapConnectError(err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestWithTxCommitsAndRollsBack(t *testing.T) {
+	table := testTable(t, "test_tx", "id int PRIMARY KEY")
+	p := testPool(t)
+	ctx := testContext(t)
+	if err := p.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO "+table+" VALUES (1)")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("fail")
+	if err := p.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO "+table+" VALUES (2)"); err != nil {
+			return err
+		}
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Fatalf("WithTx returned %v, want the error of fn", err)
+	}
+	ids, err := Select[int](ctx, p, "SELECT id FROM "+table+" ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("table holds %v, want only the committed row 1", ids)
+	}
+}
+
+func TestWithTxSearchPath(t *testing.T) {
+	schema := testName("test_schema")
+	testObject(t, "CREATE SCHEMA "+schema, "DROP SCHEMA "+schema+" CASCADE")
+	p := testPool(t, WithMaxConns(1))
+	ctx := testContext(t)
+	before, err := Scalar[string](ctx, p, "SHOW search_path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WithTxSearchPath(ctx, schema, func(tx *Tx) error {
+		current, err := Scalar[string](ctx, tx, "SELECT current_schema()")
+		if err != nil {
+			return err
+		}
+		if current != schema {
+			t.Errorf("current_schema() = %q inside the transaction, want %q", current, schema)
+		}
+		_, err = tx.Exec(ctx, "CREATE TABLE in_schema (id int)")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	exists, err := Exists(ctx, p, "SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = 'in_schema')", schema)
+	if err != nil || !exists {
+		t.Errorf("table created in the transaction is not in %s: %v, %v", schema, exists, err)
+	}
+	after, err := Scalar[string](ctx, p, "SHOW search_path")
+	if err != nil || after != before {
+		t.Errorf("search_path after the transaction = %q, %v, want %q", after, err, before)
+	}
+}
+
+func TestWithTxSearchPathConcurrent(t *testing.T) {
+	schemas := []string{testName("test_schema_a"), testName("test_schema_b")}
+	for _, schema := range schemas {
+		testObject(t, "CREATE SCHEMA "+schema, "DROP SCHEMA "+schema+" CASCADE")
+	}
+	p := testPool(t, WithMaxConns(2))
+	ctx := testContext(t)
+	// Both transactions set their search_path before either checks it, so each check runs while the other is still open.
+	var set sync.WaitGroup
+	set.Add(len(schemas))
+	both := make(chan struct{})
+	go func() {
+		set.Wait()
+		close(both)
+	}()
+	errs := make(chan error, len(schemas))
+	for _, schema := range schemas {
+		go func(schema string) {
+			errs <- p.WithTxSearchPath(ctx, schema, func(tx *Tx) error {
+				set.Done()
+				select {
+				case <-both:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				current, err := Scalar[string](ctx, tx, "SELECT current_schema()")
+				if err != nil {
+					return err
+				}
+				if current != schema {
+					t.Errorf("current_schema() = %q with another transaction open, want %q", current, schema)
+				}
+				return nil
+			})
+		}(schema)
+	}
+	for range schemas {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWithTxSearchPathRejectsInvalidSchema(t *testing.T) {
+	p := &Pool{}
+	for _, schema := range []string{"", "a\x00b"} {
+		if err := p.WithTxSearchPath(context.Background(), schema, func(*Tx) error { return nil }); err == nil {
+			t.Errorf("WithTxSearchPath accepted the schema %q", schema)
+		}
+	}
+}
+
+func TestWithBudgetRejectsShortBudget(t *testing.T) {
+	if err := (&Pool{}).WithBudget(context.Background(), time.Microsecond, func(*Tx) error { return nil }); err == nil {
+		t.Error("WithBudget accepted a budget under 1ms")
+	}
+}
+
+func TestWithBudgetCancelsOnBothSides(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	var pid uint32
+	start := time.Now()
+	err := p.WithBudget(ctx, 300*time.Millisecond, func(tx *Tx) error {
+		pid = tx.Conn().PgConn().PID()
+		timeout, err := Scalar[string](ctx, tx, "SELECT current_setting('statement_timeout')")
+		if err != nil {
+			return err
+		}
+		if ms, err := strconv.Atoi(strings.TrimSuffix(timeout, "ms")); err != nil || ms <= 0 || ms > 300 {
+			t.Errorf("statement_timeout = %q inside the budget, want at most 300ms", timeout)
+		}
+		_, err = tx.Exec(ctx, "SELECT pg_sleep(5)")
+		return err
+	})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("WithBudget returned after %s, want about the 300ms budget", elapsed)
+	}
+	if sqlState(err) != "57014" && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WithBudget = %v, want query_canceled or the deadline", err)
+	}
+	// Whichever side gave up first, the server is no longer running the statement.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		running, err := Exists(ctx, p, "SELECT EXISTS(SELECT 1 FROM pg_stat_activity WHERE pid = $1 AND state = 'active' AND query LIKE '%pg_sleep(5)%')", int(pid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the server still runs the statement after the budget")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if timeout, err := Scalar[string](ctx, p, "SHOW statement_timeout"); err != nil || timeout != "0" {
+		t.Errorf("statement_timeout after the transaction = %q, %v, want it reverted to 0", timeout, err)
+	}
+}
+
+func TestHelpersOnTx(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server, WithNullAsZero())
+	ctx := testContext(t)
+	columns := []fakeColumn{{name: "id", oid: pgtype.Int8OID}, {name: "customerName", oid: pgtype.TextOID}}
+	server.answer("SELECT id, customerName FROM orders", columns, []any{int64(1), "ann"}, []any{int64(2), "bob"})
+	server.answer("SELECT max(id) FROM orders WHERE false", []fakeColumn{{name: "max", oid: pgtype.Int8OID}}, []any{nil})
+	err := p.WithTx(ctx, func(tx *Tx) error {
+		orders, err := Select[testOrder](ctx, tx, "SELECT id, customerName FROM orders")
+		if err != nil {
+			return err
+		}
+		if want := []testOrder{{1, "ann"}, {2, "bob"}}; !reflect.DeepEqual(orders, want) {
+			t.Errorf("Select on the Tx = %v, want %v", orders, want)
+		}
+		// NULL scanning as zero shows the Tx carries the pool's helper configuration.
+		latest, err := Scalar[int64](ctx, tx, "SELECT max(id) FROM orders WHERE false")
+		if err != nil || latest != 0 {
+			t.Errorf("Scalar of NULL on the Tx = %d, %v, want 0 with WithNullAsZero", latest, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"begin", "SELECT id, customerName FROM orders", "SELECT max(id) FROM orders WHERE false", "commit"}
+	if got := drainQueries(server); !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestWithDeferrableReadOnlyTxBegin(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	if err := p.WithDeferrableReadOnlyTx(testContext(t), func(*Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"begin isolation level serializable read only deferrable", "commit"}
+	if got := drainQueries(server); !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestWithDeferrableReadOnlyTx(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	err := p.WithDeferrableReadOnlyTx(ctx, func(tx *Tx) error {
+		var isolation, readOnly, deferrable string
+		if err := tx.QueryRow(ctx, `SELECT current_setting('transaction_isolation'), current_setting('transaction_read_only'),
+			current_setting('transaction_deferrable')`).Scan(&isolation, &readOnly, &deferrable); err != nil {
+			return err
+		}
+		if isolation != "serializable" || readOnly != "on" || deferrable != "on" {
+			t.Errorf("transaction is %s, read only %s, deferrable %s, want serializable, on, on", isolation, readOnly, deferrable)
+		}
+		_, err := tx.Exec(ctx, "CREATE TABLE "+testName("deferrable_write")+" (id int)")
+		return err
+	})
+	if !IsReadOnlyTransaction(err) {
+		t.Errorf("write in the transaction = %v, want a read-only error", err)
+	}
+}
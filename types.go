@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Registers the composite type name and its array type on every new connection, so it can be scanned into and bound from Go structs.
+// exampleValue (may be nil) is a Go value, e.g. MyStruct{}, that should be encoded as this type by default.
+// Types a composite depends on must be registered first, so pass the options in dependency order.
+func WithCompositeType(name string, exampleValue any) Option {
+	return func(options *options) error {
+		if name == "" {
+			return fmt.Errorf("composite type name cannot be empty")
+		}
+		options.afterconnect = append(options.afterconnect, registerType(name, exampleValue))
+		return nil
+	}
+}
+
+func registerType(name string, exampleValue any) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		typeMap := conn.TypeMap()
+		for _, typeName := range []string{name, name + "[]"} {
+			typ, err := conn.LoadType(ctx, typeName)
+			if err != nil {
+				return fmt.Errorf("load type %s: %w", typeName, err)
+			}
+			typeMap.RegisterType(typ)
+		}
+		if exampleValue != nil {
+			typeMap.RegisterDefaultPgType(exampleValue, name)
+		}
+		return nil
+	}
+}
+
+// Registers the enum type name and its array type on every new connection. Enum values are scanned into and bound from string
+// and any Go type whose underlying type is string, e.g. type Status string, with or without this option; registering is needed to
+// scan and bind enum arrays, e.g. []Status, and lets pgx use the binary format for the type. Values are not checked on the client:
+// binding a string that is not a label of the enum fails on the server.
+func WithEnumType(name string) Option {
+	return func(options *options) error {
+		if name == "" {
+			return fmt.Errorf("enum type name cannot be empty")
+		}
+		options.afterconnect = append(options.afterconnect, registerType(name, nil))
+		return nil
+	}
+}
+
+// Duration is a time.Duration that scans from and binds as an interval. pgx also scans intervals into time.Duration, counting
+// a month as 30 days; Duration instead rejects intervals with a month or year part, which have no fixed length, so a value such as
+// '1 month' is never silently approximated. A day counts as 24 hours. Bound values are sent as microseconds, e.g. '36:00:00'.
+//
+// Range types such as int4range or tstzrange scan into pgtype.Range[T], e.g. Scalar[pgtype.Range[int32]], with the bounds in
+// Lower and Upper and their kind (pgtype.Inclusive, Exclusive or Unbounded) in LowerType and UpperType; they bind back as is.
+// Note that the server normalizes discrete ranges, so [1,3] reads back as [1,4).
+type Duration time.Duration
+
+func (d *Duration) ScanInterval(v pgtype.Interval) error {
+	if !v.Valid {
+		return fmt.Errorf("cannot scan NULL into *postgres.Duration")
+	}
+	if v.Months != 0 {
+		return fmt.Errorf("cannot scan interval with %d months into *postgres.Duration: months have no fixed length", v.Months)
+	}
+	*d = Duration(time.Duration(int64(v.Days)*24*int64(time.Hour/time.Microsecond)+v.Microseconds) * time.Microsecond)
+	return nil
+}
+
+func (d Duration) IntervalValue() (pgtype.Interval, error) {
+	return pgtype.Interval{Microseconds: time.Duration(d).Microseconds(), Valid: true}, nil
+}
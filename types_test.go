@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTypeOptionsRejectEmptyName(t *testing.T) {
+	for name, option := range map[string]Option{
+		"WithCompositeType": WithCompositeType("", nil),
+		"WithEnumType":      WithEnumType(""),
+	} {
+		if err := option(&options{}); err == nil {
+			t.Errorf("%s accepted an empty type name", name)
+		}
+	}
+}
+
+type testComposite struct {
+	X int32
+	Y string
+}
+
+func TestCompositeType(t *testing.T) {
+	name := testName("test_composite")
+	testObject(t, "CREATE TYPE "+name+" AS (x int4, y text)", "DROP TYPE "+name)
+	p := testPool(t, WithCompositeType(name, testComposite{}))
+	ctx := testContext(t)
+
+	value, err := Scalar[testComposite](ctx, p, "SELECT ROW(1, 'one')::"+name)
+	if err != nil || value != (testComposite{1, "one"}) {
+		t.Errorf("Scalar = %+v, %v, want {1 one}", value, err)
+	}
+	values, err := Scalar[[]testComposite](ctx, p, "SELECT ARRAY[ROW(1, 'one'), ROW(2, 'two')]::"+name+"[]")
+	if err != nil || len(values) != 2 || values[1] != (testComposite{2, "two"}) {
+		t.Errorf("Scalar of the array = %+v, %v", values, err)
+	}
+	// the example value makes testComposite bind as the composite type
+	y, err := Scalar[string](ctx, p, "SELECT ($1::"+name+").y", testComposite{3, "three"})
+	if err != nil || y != "three" {
+		t.Errorf("bound composite has y = %q, %v, want three", y, err)
+	}
+}
+
+func TestCompositeTypeUnknown(t *testing.T) {
+	_, err := New(testContext(t), append(testOptions(t), WithCompositeType(testName("missing_type"), nil))...)
+	if err == nil {
+		t.Fatal("New succeeded with a composite type that does not exist")
+	}
+}
+
+type testStatus string
+
+const (
+	testStatusOpen   testStatus = "open"
+	testStatusClosed testStatus = "closed"
+)
+
+func TestEnumIntoTypedString(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	// An enum the pool has not registered has an OID pgx does not know, and arrives as text.
+	const enum_oid = 91234
+	server.answer("SELECT status FROM orders", []fakeColumn{{name: "status", oid: enum_oid}}, []any{"open"}, []any{"closed"})
+	statuses, err := Select[testStatus](ctx, p, "SELECT status FROM orders")
+	if want := []testStatus{testStatusOpen, testStatusClosed}; err != nil || !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Select of an enum column = %q, %v, want %q", statuses, err, want)
+	}
+}
+
+func TestEnumType(t *testing.T) {
+	name := testName("test_status")
+	testObject(t, "CREATE TYPE "+name+" AS ENUM ('open', 'closed')", "DROP TYPE "+name)
+	ctx := testContext(t)
+
+	// Without registering, single values scan into and bind from the typed string.
+	plain := testPool(t)
+	status, err := Scalar[testStatus](ctx, plain, "SELECT 'closed'::"+name)
+	if err != nil || status != testStatusClosed {
+		t.Errorf("Scalar of the enum = %q, %v, want closed", status, err)
+	}
+	if same, err := Scalar[bool](ctx, plain, "SELECT $1::"+name+" = 'open'", testStatusOpen); err != nil || !same {
+		t.Errorf("bound typed string compares as %t, %v, want true", same, err)
+	}
+
+	p := testPool(t, WithEnumType(name))
+	statuses, err := ScanArray[testStatus](ctx, p, "SELECT ARRAY['open', 'closed']::"+name+"[]")
+	if want := []testStatus{testStatusOpen, testStatusClosed}; err != nil || !reflect.DeepEqual(statuses, want) {
+		t.Errorf("ScanArray of the enum array = %q, %v, want %q", statuses, err, want)
+	}
+	if n, err := Scalar[int](ctx, p, "SELECT cardinality($1::"+name+"[])", []testStatus{testStatusOpen, testStatusOpen}); err != nil || n != 2 {
+		t.Errorf("bound enum array has %d elements, %v, want 2", n, err)
+	}
+	if _, err := Scalar[testStatus](ctx, p, "SELECT $1::"+name, testStatus("unknown")); err == nil {
+		t.Error("binding a string that is not a label succeeded")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	ctx := testContext(t)
+	interval := []fakeColumn{{name: "interval", oid: pgtype.IntervalOID}}
+	server.answer("SELECT day_and_a_half", interval, []any{pgtype.Interval{Days: 1, Microseconds: 12 * 3600 * 1e6, Valid: true}})
+	server.answer("SELECT month", interval, []any{pgtype.Interval{Months: 1, Valid: true}})
+	server.answer("SELECT null_interval", interval, []any{nil})
+	d, err := Scalar[Duration](ctx, p, "SELECT day_and_a_half")
+	if err != nil || time.Duration(d) != 36*time.Hour {
+		t.Errorf("Scalar[Duration] of 1 day 12:00:00 = %s, %v, want 36h", time.Duration(d), err)
+	}
+	if _, err := Scalar[Duration](ctx, p, "SELECT month"); err == nil || !strings.Contains(err.Error(), "months") {
+		t.Errorf("Scalar[Duration] of 1 mon = %v, want the month rejected", err)
+	}
+	if _, err := Scalar[Duration](ctx, p, "SELECT null_interval"); err == nil {
+		t.Error("Scalar[Duration] of NULL succeeded")
+	}
+	value, err := Duration(90 * time.Minute).IntervalValue()
+	if want := (pgtype.Interval{Microseconds: 90 * 60 * 1e6, Valid: true}); err != nil || value != want {
+		t.Errorf("IntervalValue of 90m = %+v, %v, want %+v", value, err, want)
+	}
+}
+
+func TestRange(t *testing.T) {
+	server := newAcceptingServer(t)
+	p := fakePool(t, server)
+	span := pgtype.Range[pgtype.Int4]{Lower: pgtype.Int4{Int32: 1, Valid: true}, LowerType: pgtype.Inclusive,
+		UpperType: pgtype.Unbounded, Valid: true}
+	server.answer("SELECT span", []fakeColumn{{name: "span", oid: pgtype.Int4rangeOID}}, []any{span})
+	got, err := Scalar[pgtype.Range[int32]](testContext(t), p, "SELECT span")
+	if err != nil || got.Lower != 1 || got.LowerType != pgtype.Inclusive || got.UpperType != pgtype.Unbounded || !got.Valid {
+		t.Errorf("Scalar of [1,) = %+v, %v, want lower 1 inclusive and no upper bound", got, err)
+	}
+}
+
+func TestDurationAndRangeOnServer(t *testing.T) {
+	p := testPool(t)
+	ctx := testContext(t)
+	for _, d := range []time.Duration{0, 1500 * time.Millisecond, 36 * time.Hour, -time.Minute} {
+		got, err := Scalar[Duration](ctx, p, "SELECT $1::interval", Duration(d))
+		if err != nil || time.Duration(got) != d {
+			t.Errorf("Duration %s read back as %s, %v", d, time.Duration(got), err)
+		}
+	}
+	if _, err := Scalar[Duration](ctx, p, "SELECT interval '1 year 2 days'"); err == nil {
+		t.Error("Scalar[Duration] of an interval with years succeeded")
+	}
+	span, err := Scalar[pgtype.Range[int32]](ctx, p, "SELECT int4range(1, 3, '[]')")
+	if want := (pgtype.Range[int32]{Lower: 1, Upper: 4, LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive, Valid: true}); err != nil || span != want {
+		t.Errorf("int4range(1, 3, '[]') = %+v, %v, want %+v", span, err, want)
+	}
+	if contains, err := Scalar[bool](ctx, p, "SELECT $1::int4range @> 3", span); err != nil || !contains {
+		t.Errorf("bound range contains 3 = %t, %v, want true", contains, err)
+	}
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GradualWarmup spreads the creation of the WithMinConns connections over the health check period instead of opening them all
+// at once when the pool starts, which smooths the load a fleet of freshly deployed instances puts on the database. Only the
+// connections the pool opens in the background to reach MinConns follow the ramp, connections needed by callers, including the
+// startup ping, are opened right away. The ramp runs independently of New's context and is stopped by Close.
+func WithGradualWarmup(enabled bool) Option {
+	return func(options *options) error {
+		options.gradualwarmup = enabled
+		return nil
+	}
+}
+
+type warmupKey struct{}
+
+// warmupContext marks ctx as the context the pool creates its MinConns connections with, the only connections held to the ramp.
+func warmupContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, warmupKey{}, true)
+}
+
+// applyGradualWarmup spaces the first MinConns connections of cfg evenly over its health check period. It reports whether it did,
+// in which case the pool must be created with a context from warmupContext.
+func applyGradualWarmup(cfg *pgxpool.Config, opt *options) bool {
+	if !opt.gradualwarmup || cfg.MinConns < 2 || cfg.HealthCheckPeriod <= 0 {
+		return false
+	}
+	count := int64(cfg.MinConns)
+	interval := cfg.HealthCheckPeriod / time.Duration(count)
+	var start time.Time
+	var startOnce sync.Once
+	var slot atomic.Int64
+	previous := cfg.BeforeConnect
+	cfg.BeforeConnect = func(ctx context.Context, config *pgx.ConnConfig) error {
+		if ctx.Value(warmupKey{}) == nil {
+			return connect(ctx, config, previous)
+		}
+		startOnce.Do(func() { start = time.Now() })
+		if n := slot.Add(1) - 1; n < count {
+			timer := time.NewTimer(time.Until(start.Add(time.Duration(n) * interval)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		return connect(ctx, config, previous)
+	}
+	return true
+}
+
+// connect runs the BeforeConnect hook that was installed before the warmup's, if any.
+func connect(ctx context.Context, config *pgx.ConnConfig, previous func(context.Context, *pgx.ConnConfig) error) error {
+	if previous != nil {
+		return previous(ctx, config)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func warmupConfig(t *testing.T, minConns int32, period time.Duration) (*pgxpool.Config, *atomic.Int32) {
+	t.Helper()
+	cfg, err := pgxpool.ParseConfig("postgres://user@127.0.0.1:1/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MinConns, cfg.HealthCheckPeriod = minConns, period
+	var previous atomic.Int32
+	cfg.BeforeConnect = func(context.Context, *pgx.ConnConfig) error {
+		previous.Add(1)
+		return nil
+	}
+	return cfg, &previous
+}
+
+func TestGradualWarmupDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		minConns int32
+		period   time.Duration
+	}{
+		{"off", false, 4, time.Second},
+		{"one connection", true, 1, time.Second},
+		{"no health check", true, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := warmupConfig(t, tt.minConns, tt.period)
+			if applyGradualWarmup(cfg, &options{gradualwarmup: tt.enabled}) {
+				t.Error("applyGradualWarmup reported a ramp")
+			}
+		})
+	}
+}
+
+func TestGradualWarmupSpacesPoolConnections(t *testing.T) {
+	const period = 300 * time.Millisecond
+	cfg, previous := warmupConfig(t, 3, period)
+	if !applyGradualWarmup(cfg, &options{gradualwarmup: true}) {
+		t.Fatal("applyGradualWarmup did not install the ramp")
+	}
+	ctx := warmupContext(context.Background())
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := cfg.BeforeConnect(ctx, cfg.ConnConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// slots are at 0, period/3 and 2*period/3
+	if elapsed := time.Since(start); elapsed < 2*period/3-10*time.Millisecond {
+		t.Errorf("three ramp connections took %v, want about %v", elapsed, 2*period/3)
+	}
+	begin := time.Now()
+	if err := cfg.BeforeConnect(ctx, cfg.ConnConfig); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 50*time.Millisecond {
+		t.Errorf("connection after the ramp waited %v", elapsed)
+	}
+	if n := previous.Load(); n != 4 {
+		t.Errorf("previous BeforeConnect ran %d times, want 4", n)
+	}
+}
+
+func TestGradualWarmupDoesNotHoldCallers(t *testing.T) {
+	cfg, previous := warmupConfig(t, 4, time.Hour)
+	applyGradualWarmup(cfg, &options{gradualwarmup: true})
+	// a ramp connection takes slot 0, the next ramp slot would be 15 minutes away
+	if err := cfg.BeforeConnect(warmupContext(context.Background()), cfg.ConnConfig); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := cfg.BeforeConnect(context.Background(), cfg.ConnConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("caller connections waited %v for the ramp", elapsed)
+	}
+	if n := previous.Load(); n != 5 {
+		t.Errorf("previous BeforeConnect ran %d times, want 5", n)
+	}
+}
+
+func TestGradualWarmupStopsWithContext(t *testing.T) {
+	cfg, previous := warmupConfig(t, 2, time.Hour)
+	applyGradualWarmup(cfg, &options{gradualwarmup: true})
+	bg, stop := context.WithCancel(context.Background())
+	ctx := warmupContext(bg)
+	if err := cfg.BeforeConnect(ctx, cfg.ConnConfig); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cfg.BeforeConnect(ctx, cfg.ConnConfig) }()
+	stop()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("waiting ramp connection returned %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting ramp connection was not released by cancelling its context")
+	}
+	if n := previous.Load(); n != 1 {
+		t.Errorf("previous BeforeConnect ran %d times, want 1", n)
+	}
+}